@@ -0,0 +1,152 @@
+package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+func (app *application) markAttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Marks    []data.Mark `json:"marks"`
+		Override bool        `json:"override"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateMarks(v, input.Marks); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.Override {
+		allowed, err := app.hasPermission(r, "attendance:override")
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	lesson, err := app.models.Lessons.GetLesson(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	marks, err := app.models.Attendance.Mark(lesson, input.Marks, input.Override, user.ID)
+	if err != nil {
+		var studentErr *data.StudentError
+		studentID := ""
+		if errors.As(err, &studentErr) {
+			studentID = studentErr.StudentID.String()
+		}
+
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrLessonCancelled):
+			v.AddError("lesson", "урок отменен")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrStudentNotInGroup):
+			v.AddError("marks", fmt.Sprintf("студент %s не записан в группу на дату урока", studentID))
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrNoValidSubscription):
+			v.AddError("marks", fmt.Sprintf("у студента %s нет действующего абонемента", studentID))
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"lesson": lesson, "attendance": marks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listAttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Lessons.GetLesson(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	marks, err := app.models.Attendance.GetAllForLesson(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"attendance": marks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	studentID, err := app.readUUIDParam(r, "student_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Attendance.DeleteMark(id, studentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "отметка удалена"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
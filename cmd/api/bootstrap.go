@@ -0,0 +1,35 @@
+package main
+
+import (
+	"authCRM/internal/data"
+	"errors"
+	"fmt"
+)
+
+// bootstrapAdmin makes the user with the given email an admin. Every role
+// endpoint needs users:write, so the first admin of a fresh install has to be
+// created from the command line: register the account, then run the server
+// once with -bootstrap-admin=<email>.
+func (app *application) bootstrapAdmin(email string) error {
+	user, err := app.models.Users.GetByEmail(email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return fmt.Errorf("no registered user with email %q", email)
+		default:
+			return err
+		}
+	}
+
+	err = app.models.Permissions.GrantRole(user, data.RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("granted admin role", map[string]string{
+		"user_id": user.ID.String(),
+		"email":   user.Email,
+	})
+
+	return nil
+}
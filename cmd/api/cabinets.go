@@ -167,7 +167,7 @@ func (app *application) listCabinetsHandler(w http.ResponseWriter, r *http.Reque
 
 	cabinetInput.Filters.Sort = app.readString(qs, "sort", "id")
 
-	cabinetInput.Filters.SortSafelist = []string{"id", "-id"}
+	cabinetInput.Filters.SortSafelist = []string{"id", "name", "address", "-id", "-name", "-address"}
 	if data.ValidateFilters(v, cabinetInput.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
@@ -176,6 +176,7 @@ func (app *application) listCabinetsHandler(w http.ResponseWriter, r *http.Reque
 	cabinets, metadata, err := app.models.Cabinets.GetAllCabinets(cabinetInput.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"Cabinets": cabinets, "metadata": metadata}, nil)
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/validator"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+// refundQuoteHandler shows what cancelling the subscription would refund,
+// without cancelling it. ?date= defaults to today, ?fee= to no fee.
+func (app *application) refundQuoteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	c := &data.Cancellation{
+		StudentSubscriptionID: id,
+		Date:                  dateOrToday(app.readDate(qs, "date", v)),
+		Fee:                   int64(app.readInt(qs, "fee", 0, v)),
+	}
+
+	if data.ValidateCancellation(v, c); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Cancellations.Quote(c)
+	if err != nil {
+		app.cancellationErrorResponse(w, r, v, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"cancellation": c}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) cancelSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Date            *time.Time `json:"date"`
+		Fee             int64      `json:"fee"`
+		Reason          string     `json:"reason"`
+		PaymentMethodID *uuid.UUID `json:"payment_method_id"`
+		CategoryID      *uuid.UUID `json:"category_id"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	c := &data.Cancellation{
+		StudentSubscriptionID: id,
+		Date:                  dateOrToday(input.Date),
+		Fee:                   input.Fee,
+		Reason:                input.Reason,
+		PaymentMethodID:       input.PaymentMethodID,
+		ApprovedBy:            &user.ID,
+	}
+
+	categoryID := data.RefundExpenseCategoryID
+	if input.CategoryID != nil {
+		categoryID = *input.CategoryID
+	}
+
+	v := validator.New()
+
+	v.Check(c.Reason != "", "reason", "должны указать причину!")
+
+	if data.ValidateCancellation(v, c); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkCategory(w, r, v, data.CategoryExpense, categoryID) {
+		return
+	}
+
+	if c.PaymentMethodID != nil && !app.checkPaymentMethod(w, r, v, *c.PaymentMethodID) {
+		return
+	}
+
+	err = app.models.Cancellations.Cancel(c, categoryID)
+	if err != nil {
+		app.cancellationErrorResponse(w, r, v, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/student-subscription/%s/cancellation", c.StudentSubscriptionID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"cancellation": c}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getCancellationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	c, err := app.models.Cancellations.GetCancellation(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"cancellation": c}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) cancellationErrorResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrAlreadyCancelled):
+		app.errorResponse(w, r, http.StatusConflict, "подписка уже отменена")
+	case errors.Is(err, data.ErrRefundMethodRequired):
+		v.AddError("payment_method_id", "должны указать способ оплаты для возврата!")
+		app.failedValidationResponse(w, r, v.Errors)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
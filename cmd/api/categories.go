@@ -0,0 +1,213 @@
+package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/validator"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// The income and expense category endpoints only differ in the table they
+// work on, so each handler is built for a category kind.
+
+func categoryPath(kind data.CategoryKind) string {
+	return fmt.Sprintf("/v1/%s-items", kind)
+}
+
+func (app *application) createCategoryHandler(kind data.CategoryKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Name     string     `json:"name"`
+			ParentID *uuid.UUID `json:"parent_id"`
+		}
+
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		category := &data.Category{
+			Kind:     kind,
+			Name:     input.Name,
+			ParentID: input.ParentID,
+		}
+
+		v := validator.New()
+
+		if data.ValidateCategory(v, category); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = app.models.Categories.InsertCategory(category)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrUnknownParent):
+				v.AddError("parent_id", "родительская статья не найдена")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		headers := make(http.Header)
+		headers.Set("Location", fmt.Sprintf("%s/%s", categoryPath(kind), category.ID))
+
+		err = app.writeJSON(w, http.StatusCreated, envelope{"category": category}, headers)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (app *application) getCategoryHandler(kind data.CategoryKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		category, err := app.models.Categories.GetCategory(kind, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"category": category}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (app *application) updateCategoryHandler(kind data.CategoryKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		category, err := app.models.Categories.GetCategory(kind, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// An empty parent_id moves the category to the top level.
+		var input struct {
+			Name     *string `json:"name"`
+			ParentID *string `json:"parent_id"`
+		}
+
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if input.Name != nil {
+			category.Name = *input.Name
+		}
+
+		v := validator.New()
+
+		if input.ParentID != nil {
+			category.ParentID = nil
+			if *input.ParentID != "" {
+				parentID, err := uuid.Parse(*input.ParentID)
+				if err != nil {
+					v.AddError("parent_id", "неверный идентификатор статьи")
+					app.failedValidationResponse(w, r, v.Errors)
+					return
+				}
+				category.ParentID = &parentID
+			}
+		}
+
+		if data.ValidateCategory(v, category); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = app.models.Categories.UpdateCategory(category)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrCategoryCycle):
+				v.AddError("parent_id", "нельзя вложить статью в её же подстатью")
+				app.failedValidationResponse(w, r, v.Errors)
+			case errors.Is(err, data.ErrUnknownParent):
+				v.AddError("parent_id", "родительская статья не найдена")
+				app.failedValidationResponse(w, r, v.Errors)
+			case errors.Is(err, data.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"category": category}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (app *application) deleteCategoryHandler(kind data.CategoryKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		err = app.models.Categories.DeleteCategory(kind, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			case errors.Is(err, data.ErrCategoryInUse):
+				app.errorResponse(w, r, http.StatusConflict, "у статьи есть подстатьи или операции")
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"message": "успешно удалено"}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (app *application) listCategoriesHandler(kind data.CategoryKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		categories, err := app.models.Categories.GetAllCategories(kind)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"categories": categories}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
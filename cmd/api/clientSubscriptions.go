@@ -1 +1,262 @@
 package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/validator"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (app *application) sellSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	studentID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		SubscriptionID string    `json:"subscription_id"`
+		StartDate      time.Time `json:"start_date"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	student, err := app.models.Students.GetStudent(studentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+
+	planID, err := uuid.Parse(input.SubscriptionID)
+	if err != nil {
+		v.AddError("subscription_id", "неверный идентификатор подписки")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	plan, err := app.models.Subscriptions.GetSubscription(planID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("subscription_id", "подписка не найдена")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if plan.ArchivedAt != nil {
+		v.AddError("subscription_id", "подписка в архиве и не продаётся")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ss := data.NewStudentSubscription(student.ID, plan, input.StartDate)
+
+	if data.ValidateStudentSubscription(v, ss); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.StudentSubscriptions.InsertStudentSubscription(ss)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/student-subscription/%s", ss.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"student_subscription": ss}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listStudentSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	studentID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	subs, err := app.models.StudentSubscriptions.GetAllForStudent(studentID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"student_subscriptions": subs}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getStudentSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ss, err := app.models.StudentSubscriptions.GetStudentSubscription(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"student_subscription": ss}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createFreezeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		StartDate time.Time `json:"start_date"`
+		EndDate   time.Time `json:"end_date"`
+		Reason    string    `json:"reason"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ss, err := app.models.StudentSubscriptions.GetStudentSubscription(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	freeze := &data.Freeze{
+		StartDate: data.TruncateToDate(input.StartDate),
+		EndDate:   data.TruncateToDate(input.EndDate),
+		Reason:    input.Reason,
+		CreatedBy: &user.ID,
+	}
+
+	v := validator.New()
+
+	if data.ValidateFreeze(v, freeze, ss); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Freezes.InsertFreeze(ss, freeze)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrFreezeNotAllowed):
+			v.AddError("subscription", "план подписки не допускает заморозку")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrFreezeOverlap):
+			v.AddError("start_date", "пересекается с другой заморозкой")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrFreezeLimitExceeded):
+			v.AddError("end_date", fmt.Sprintf("превышен лимит заморозки в %d дней", *ss.MaxFreezeDays))
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Freezes.ApplyFreezes()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// A freeze starting today changes the status; re-read it so the response
+	// doesn't show the old one.
+	ss, err = app.models.StudentSubscriptions.GetStudentSubscription(ss.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"freeze": freeze, "student_subscription": ss}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listFreezesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	freezes, err := app.models.Freezes.GetAllForSubscription(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"freezes": freezes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshSubscriptionStatuses periodically applies freezes and moves sold
+// subscriptions that ran out of time or sessions out of the active status.
+func (app *application) refreshSubscriptionStatuses(interval time.Duration) {
+	for {
+		err := app.models.Freezes.ApplyFreezes()
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+
+		n, err := app.models.StudentSubscriptions.ExpireOverdue()
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		} else if n > 0 {
+			app.logger.PrintInfo("expired student subscriptions", map[string]string{
+				"count": strconv.FormatInt(n, 10),
+			})
+		}
+
+		time.Sleep(interval)
+	}
+}
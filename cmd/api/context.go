@@ -0,0 +1,54 @@
+package main
+
+import (
+	"authCRM/internal/data"
+	"context"
+	"golang.org/x/time/rate"
+	"net/http"
+)
+
+type contextKey string
+
+const (
+	userContextKey      = contextKey("user")
+	apiKeyContextKey    = contextKey("apiKey")
+	ipLimiterContextKey = contextKey("ipLimiter")
+)
+
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+
+	return user
+}
+
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKey returns the API key used to authenticate the request, or
+// nil when the caller used a bearer token or is anonymous.
+func (app *application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
+
+func (app *application) contextSetIPLimiter(r *http.Request, limiter *rate.Limiter) *http.Request {
+	ctx := context.WithValue(r.Context(), ipLimiterContextKey, limiter)
+	return r.WithContext(ctx)
+}
+
+// contextGetIPLimiter returns the caller's per-IP rate limiter for a request
+// that carries an API key, or nil when the limiter is disabled.
+func (app *application) contextGetIPLimiter(r *http.Request) *rate.Limiter {
+	limiter, _ := r.Context().Value(ipLimiterContextKey).(*rate.Limiter)
+	return limiter
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/validator"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+func (app *application) createGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var groupInput struct {
+		Name      string     `json:"name"`
+		Course    string     `json:"course"`
+		TeacherID *uuid.UUID `json:"teacher_id"`
+		CabinetID *uuid.UUID `json:"cabinet_id"`
+		Capacity  int        `json:"capacity"`
+		Level     string     `json:"level"`
+		StartDate time.Time  `json:"start_date"`
+		EndDate   *time.Time `json:"end_date"`
+	}
+
+	err := app.readJSON(w, r, &groupInput)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	group := &data.Group{
+		Name:      groupInput.Name,
+		Course:    groupInput.Course,
+		TeacherID: groupInput.TeacherID,
+		CabinetID: groupInput.CabinetID,
+		Capacity:  groupInput.Capacity,
+		Level:     groupInput.Level,
+		StartDate: data.TruncateToDate(groupInput.StartDate),
+	}
+
+	if groupInput.EndDate != nil {
+		endDate := data.TruncateToDate(*groupInput.EndDate)
+		group.EndDate = &endDate
+	}
+
+	v := validator.New()
+
+	if data.ValidateGroup(v, group); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkTeacherAndCabinet(w, r, v, group.TeacherID, group.CabinetID) {
+		return
+	}
+
+	err = app.models.Groups.InsertGroup(group)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/group/%s", group.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"group": group}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getGroupHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	group, err := app.models.Groups.GetGroup(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"group": group}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	group, err := app.models.Groups.GetGroup(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var groupInput struct {
+		Name      *string    `json:"name"`
+		Course    *string    `json:"course"`
+		TeacherID *uuid.UUID `json:"teacher_id"`
+		CabinetID *uuid.UUID `json:"cabinet_id"`
+		Capacity  *int       `json:"capacity"`
+		Level     *string    `json:"level"`
+		StartDate *time.Time `json:"start_date"`
+		EndDate   *time.Time `json:"end_date"`
+	}
+
+	err = app.readJSON(w, r, &groupInput)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if groupInput.Name != nil {
+		group.Name = *groupInput.Name
+	}
+
+	if groupInput.Course != nil {
+		group.Course = *groupInput.Course
+	}
+
+	if groupInput.TeacherID != nil {
+		group.TeacherID = groupInput.TeacherID
+	}
+
+	if groupInput.CabinetID != nil {
+		group.CabinetID = groupInput.CabinetID
+	}
+
+	if groupInput.Capacity != nil {
+		group.Capacity = *groupInput.Capacity
+	}
+
+	if groupInput.Level != nil {
+		group.Level = *groupInput.Level
+	}
+
+	if groupInput.StartDate != nil {
+		group.StartDate = data.TruncateToDate(*groupInput.StartDate)
+	}
+
+	if groupInput.EndDate != nil {
+		endDate := data.TruncateToDate(*groupInput.EndDate)
+		group.EndDate = &endDate
+	}
+
+	v := validator.New()
+
+	if data.ValidateGroup(v, group); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	v.Check(group.Capacity >= group.Enrolled, "capacity", "вместимость меньше числа записанных студентов")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkTeacherAndCabinet(w, r, v, group.TeacherID, group.CabinetID) {
+		return
+	}
+
+	err = app.models.Groups.UpdateGroup(group)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"group": group}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Groups.DeleteGroup(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "успешно удалено"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	var groupInput struct {
+		Search    string
+		TeacherID string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	groupInput.Search = app.readString(qs, "search", "")
+	groupInput.TeacherID = app.readString(qs, "teacher_id", "")
+
+	groupInput.Filters.Page = app.readInt(qs, "page", 1, v)
+	groupInput.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	groupInput.Filters.Sort = app.readString(qs, "sort", "name")
+	groupInput.Filters.SortSafelist = []string{"name", "course", "start_date", "created_at", "-name", "-course", "-start_date", "-created_at"}
+
+	var teacherID *uuid.UUID
+	if groupInput.TeacherID != "" {
+		id, err := uuid.Parse(groupInput.TeacherID)
+		if err != nil {
+			v.AddError("teacher_id", "неверный идентификатор преподавателя")
+		} else {
+			teacherID = &id
+		}
+	}
+
+	if data.ValidateFilters(v, groupInput.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	groups, metadata, err := app.models.Groups.GetAllGroups(groupInput.Search, teacherID, groupInput.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"groups": groups, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listGroupStudentsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Groups.GetGroup(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	enrollments, err := app.models.Groups.GetEnrollments(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"students": enrollments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) enrollStudentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		StudentID uuid.UUID  `json:"student_id"`
+		Date      *time.Time `json:"date"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	date := dateOrToday(input.Date)
+
+	if !app.checkEnrollmentStudent(w, r, v, input.StudentID) {
+		return
+	}
+
+	enrollment, err := app.models.Groups.Enroll(id, input.StudentID, date)
+	if err != nil {
+		app.enrollmentErrorResponse(w, r, v, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"enrollment": enrollment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unenrollStudentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	studentID, err := app.readUUIDParam(r, "student_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Groups.Unenroll(id, studentID, data.TruncateToDate(time.Now()))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNotEnrolled):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrLeftBeforeEnrolled):
+			v := validator.New()
+			v.AddError("date", "дата раньше даты зачисления в группу")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "студент отчислен из группы"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) transferStudentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		StudentID uuid.UUID  `json:"student_id"`
+		ToGroupID uuid.UUID  `json:"to_group_id"`
+		Date      *time.Time `json:"date"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.ToGroupID != uuid.Nil, "to_group_id", "должны указать группу")
+	v.Check(input.ToGroupID != id, "to_group_id", "студент уже в этой группе")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkEnrollmentStudent(w, r, v, input.StudentID) {
+		return
+	}
+
+	enrollment, err := app.models.Groups.Transfer(id, input.ToGroupID, input.StudentID, dateOrToday(input.Date))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("to_group_id", "группа не найдена")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		app.enrollmentErrorResponse(w, r, v, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"enrollment": enrollment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkTeacherAndCabinet makes sure the teacher and cabinet a group or a
+// schedule points at exist, so a typo in an id comes back as a validation
+// error and not a 500.
+func (app *application) checkTeacherAndCabinet(w http.ResponseWriter, r *http.Request, v *validator.Validator, teacherID, cabinetID *uuid.UUID) bool {
+	if teacherID != nil {
+		_, err := app.models.Teachers.GetTeacher(*teacherID)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.serverErrorResponse(w, r, err)
+				return false
+			}
+			v.AddError("teacher_id", "преподаватель не найден")
+		}
+	}
+
+	if cabinetID != nil {
+		_, err := app.models.Cabinets.GetCabinet(*cabinetID)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.serverErrorResponse(w, r, err)
+				return false
+			}
+			v.AddError("cabinet_id", "кабинет не найден")
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	return true
+}
+
+func (app *application) checkEnrollmentStudent(w http.ResponseWriter, r *http.Request, v *validator.Validator, studentID uuid.UUID) bool {
+	_, err := app.models.Students.GetStudent(studentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("student_id", "студент не найден")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	return true
+}
+
+func (app *application) enrollmentErrorResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrNotEnrolled):
+		v.AddError("student_id", "студент не записан в эту группу")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrLeftBeforeEnrolled):
+		v.AddError("date", "дата раньше даты зачисления в группу")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrAlreadyEnrolled):
+		v.AddError("student_id", "студент уже записан в группу")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrGroupFull):
+		v.AddError("group", "в группе нет свободных мест")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrNoValidSubscription):
+		v.AddError("student_id", "у студента нет действующего абонемента")
+		app.failedValidationResponse(w, r, v.Errors)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -2,24 +2,33 @@ package main
 
 import (
 	"authCRM/internal/data"
+	"authCRM/internal/mailer"
 	"authCRM/internal/validator"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type envelope map[string]any
 
 func (app *application) readIDParam(r *http.Request) (uuid.UUID, error) {
+	return app.readUUIDParam(r, "id")
+}
+
+func (app *application) readUUIDParam(r *http.Request, name string) (uuid.UUID, error) {
 	params := httprouter.ParamsFromContext(r.Context())
-	idParam := params.ByName("id")
+	idParam := params.ByName(name)
 
 	id, err := uuid.Parse(idParam)
 	if err != nil {
@@ -116,6 +125,24 @@ func (app *application) readTeacherStatus(qs url.Values, key string, defaultValu
 	return defaultValue
 }
 
+func (app *application) readStudentStatus(qs url.Values, key string, defaultValue data.StudentStatus) data.StudentStatus {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	statuses := map[string]data.StudentStatus{
+		"активный":  data.StudentActive,
+		"архивный":  data.StudentArchived,
+		"заморожен": data.StudentFrozen,
+	}
+
+	if val, ok := statuses[s]; ok {
+		return val
+	}
+	return defaultValue
+}
+
 func (app *application) readGender(qs url.Values, key string, defaultValue data.Gender) data.Gender {
 	s := qs.Get(key)
 	if s == "" {
@@ -132,6 +159,21 @@ func (app *application) readGender(qs url.Values, key string, defaultValue data.
 	}
 	return defaultValue
 }
+func (app *application) readRole(qs url.Values, key string, v *validator.Validator) *data.Role {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+
+	role := data.Role(s)
+	if _, ok := data.RolePermissions[role]; !ok {
+		v.AddError(key, "неизвестная роль")
+		return nil
+	}
+
+	return &role
+}
+
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
 	s := qs.Get(key)
 
@@ -167,3 +209,126 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 
 	return i
 }
+
+// readPrice reads an optional price bound; unlike readInt it tells an absent
+// value apart from zero.
+func (app *application) readPrice(qs url.Values, key string, v *validator.Validator) *int32 {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	i, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || i < 0 {
+		v.AddError(key, "must be a non-negative integer value")
+		return nil
+	}
+
+	price := int32(i)
+
+	return &price
+}
+
+func (app *application) readBool(qs url.Values, key string, v *validator.Validator) *bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+
+	return &b
+}
+
+func (app *application) readDate(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		v.AddError(key, "must be a date in YYYY-MM-DD format")
+		return nil
+	}
+
+	return &t
+}
+
+// dateOrToday returns the calendar date of an optional date from the input,
+// or today when it was left out.
+func dateOrToday(date *time.Time) time.Time {
+	if date == nil {
+		return data.TruncateToDate(time.Now())
+	}
+	return data.TruncateToDate(*date)
+}
+
+func (app *application) readUUID(qs url.Values, key string, v *validator.Validator) *uuid.UUID {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	id, err := uuid.Parse(s)
+	if err != nil {
+		v.AddError(key, "must be a valid UUID")
+		return nil
+	}
+
+	return &id
+}
+
+func (app *application) readLanguage(r *http.Request) string {
+	if strings.HasPrefix(strings.ToLower(r.Header.Get("Accept-Language")), mailer.LangEnglish) {
+		return mailer.LangEnglish
+	}
+	return mailer.LangRussian
+}
+
+// hashEmail lets us correlate log events for one account without writing the
+// address itself to the logs.
+func hashEmail(email string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(email)))
+	return hex.EncodeToString(hash[:])
+}
+
+func (app *application) lockoutPolicy() data.LockoutPolicy {
+	return data.LockoutPolicy{
+		MaxAttempts:     app.config.login.maxAttempts,
+		BaseDelay:       app.config.login.backoff,
+		LockoutDuration: app.config.login.lockout,
+	}
+}
+
+func (app *application) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.PrintError(fmt.Errorf("%s", err), nil)
+			}
+		}()
+
+		fn()
+	}()
+}
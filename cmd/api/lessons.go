@@ -0,0 +1,331 @@
+package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/validator"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+func (app *application) createLessonHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		GroupID   uuid.UUID  `json:"group_id"`
+		TeacherID *uuid.UUID `json:"teacher_id"`
+		CabinetID *uuid.UUID `json:"cabinet_id"`
+		StartsAt  time.Time  `json:"starts_at"`
+		EndsAt    time.Time  `json:"ends_at"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	group, err := app.models.Groups.GetGroup(input.GroupID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("group_id", "группа не найдена")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	lesson := &data.Lesson{
+		GroupID:   group.ID,
+		TeacherID: group.TeacherID,
+		CabinetID: group.CabinetID,
+		Date:      data.TruncateToDate(input.StartsAt),
+		StartsAt:  input.StartsAt,
+		EndsAt:    input.EndsAt,
+		Status:    data.LessonPlanned,
+	}
+
+	if input.TeacherID != nil {
+		lesson.TeacherID = input.TeacherID
+	}
+
+	if input.CabinetID != nil {
+		lesson.CabinetID = input.CabinetID
+	}
+
+	if data.ValidateLesson(v, lesson); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkTeacherAndCabinet(w, r, v, lesson.TeacherID, lesson.CabinetID) {
+		return
+	}
+
+	err = app.models.Lessons.InsertLesson(lesson)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrLessonConflict):
+			app.respondWithConflicts(w, r, lesson)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/lesson/%s", lesson.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"lesson": lesson}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getLessonHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lesson, err := app.models.Lessons.GetLesson(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"lesson": lesson}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateLessonHandler moves a single lesson, changes its teacher or cabinet,
+// or cancels it.
+func (app *application) updateLessonHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lesson, err := app.models.Lessons.GetLesson(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		TeacherID *uuid.UUID         `json:"teacher_id"`
+		CabinetID *uuid.UUID         `json:"cabinet_id"`
+		StartsAt  *time.Time         `json:"starts_at"`
+		EndsAt    *time.Time         `json:"ends_at"`
+		Status    *data.LessonStatus `json:"status"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.TeacherID != nil {
+		lesson.TeacherID = input.TeacherID
+	}
+
+	if input.CabinetID != nil {
+		lesson.CabinetID = input.CabinetID
+	}
+
+	if input.StartsAt != nil {
+		lesson.StartsAt = *input.StartsAt
+	}
+
+	if input.EndsAt != nil {
+		lesson.EndsAt = *input.EndsAt
+	}
+
+	if input.Status != nil {
+		lesson.Status = *input.Status
+	}
+
+	v := validator.New()
+
+	if data.ValidateLesson(v, lesson); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkTeacherAndCabinet(w, r, v, lesson.TeacherID, lesson.CabinetID) {
+		return
+	}
+
+	err = app.models.Lessons.UpdateLesson(lesson)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrLessonConflict):
+			app.respondWithConflicts(w, r, lesson)
+		case errors.Is(err, data.ErrLessonConducted):
+			v.AddError("status", "проведенный урок нельзя вернуть в запланированные")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"lesson": lesson}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) respondWithConflicts(w http.ResponseWriter, r *http.Request, lesson *data.Lesson) {
+	conflicts, err := app.models.Lessons.GetConflicts(lesson)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.lessonConflictResponse(w, r, conflicts)
+}
+
+// cabinetAvailabilityHandler returns the free slots of a cabinet within
+// working hours (day_start to day_end, 08:00-21:00 by default) for each day
+// from "from" to "to".
+func (app *application) cabinetAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	today := data.TruncateToDate(time.Now())
+
+	from := app.readDate(qs, "from", v)
+	if from == nil {
+		from = &today
+	}
+
+	to := app.readDate(qs, "to", v)
+	if to == nil {
+		week := from.AddDate(0, 0, 6)
+		to = &week
+	}
+
+	dayStart := app.readString(qs, "day_start", "08:00")
+	dayEnd := app.readString(qs, "day_end", "21:00")
+
+	open, err := time.Parse("15:04", dayStart)
+	v.Check(err == nil, "day_start", "время в формате ЧЧ:ММ")
+	closed, err := time.Parse("15:04", dayEnd)
+	v.Check(err == nil, "day_end", "время в формате ЧЧ:ММ")
+	v.Check(closed.After(open), "day_end", "конец дня раньше начала")
+
+	v.Check(!to.Before(*from), "to", "дата окончания раньше даты начала")
+	v.Check(to.Sub(*from) <= 31*24*time.Hour, "to", "период не больше 31 дня")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	cabinet, err := app.models.Cabinets.GetCabinet(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	loc, err := time.LoadLocation(app.config.schedule.timezone)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	windowStart := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	windowEnd := time.Date(to.Year(), to.Month(), to.Day()+1, 0, 0, 0, 0, loc)
+
+	busy, err := app.models.Lessons.GetBusy(cabinet.ID, windowStart, windowEnd)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	slots := data.FreeSlots(busy, *from, *to, dayStart, dayEnd, loc)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"cabinet_id": cabinet.ID, "slots": slots}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listLessonsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.LessonFilter
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.LessonFilter.From = app.readDate(qs, "from", v)
+	input.LessonFilter.To = app.readDate(qs, "to", v)
+	input.LessonFilter.GroupID = app.readUUID(qs, "group_id", v)
+	input.LessonFilter.TeacherID = app.readUUID(qs, "teacher_id", v)
+	input.LessonFilter.CabinetID = app.readUUID(qs, "cabinet_id", v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "starts_at")
+	input.Filters.SortSafelist = []string{"starts_at", "created_at", "-starts_at", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// "to" is a date, the whole of that day is included.
+	if input.LessonFilter.To != nil {
+		to := input.LessonFilter.To.AddDate(0, 0, 1)
+		input.LessonFilter.To = &to
+	}
+
+	lessons, metadata, err := app.models.Lessons.GetAllLessons(input.LessonFilter, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"lessons": lessons, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
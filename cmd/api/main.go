@@ -3,13 +3,17 @@ package main
 import (
 	"authCRM/internal/data"
 	"authCRM/internal/jsonlog"
+	"authCRM/internal/mailer"
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"log"
+	"math"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -25,16 +29,45 @@ type config struct {
 		maxIdleTime  string
 	}
 	limiter struct {
-		rps     float64
-		burst   int
-		enabled bool
+		rps      float64
+		burst    int
+		enabled  bool
+		keyRps   float64
+		keyBurst int
 	}
+	login struct {
+		maxAttempts int
+		backoff     time.Duration
+		lockout     time.Duration
+	}
+	argon2 struct {
+		memory      uint
+		iterations  uint
+		parallelism uint
+	}
+	totp struct {
+		issuer  string
+		enforce bool
+	}
+	schedule struct {
+		timezone string
+	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+	bootstrapAdmin string
 }
 
 type application struct {
 	config config
 	logger *jsonlog.Logger
 	models data.Models
+	mailer mailer.Mailer
+	wg     sync.WaitGroup
 }
 
 func main() {
@@ -55,11 +88,47 @@ func main() {
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.Float64Var(&cfg.limiter.keyRps, "limiter-key-rps", 5, "Rate limiter maximum requests per second for each API key")
+	flag.IntVar(&cfg.limiter.keyBurst, "limiter-key-burst", 10, "Rate limiter maximum burst for each API key")
+
+	flag.IntVar(&cfg.login.maxAttempts, "login-max-attempts", 5, "Failed logins before an account is locked")
+	flag.DurationVar(&cfg.login.backoff, "login-backoff", time.Second, "Initial delay after a failed login, doubled on every failure")
+	flag.DurationVar(&cfg.login.lockout, "login-lockout", 15*time.Minute, "How long an account stays locked")
+
+	flag.UintVar(&cfg.argon2.memory, "argon2-memory", 64*1024, "Argon2id memory cost in KiB")
+	flag.UintVar(&cfg.argon2.iterations, "argon2-iterations", 3, "Argon2id number of iterations")
+	flag.UintVar(&cfg.argon2.parallelism, "argon2-parallelism", 2, "Argon2id degree of parallelism")
+
+	flag.StringVar(&cfg.totp.issuer, "totp-issuer", "CRM", "Issuer shown in authenticator apps")
+	flag.BoolVar(&cfg.totp.enforce, "totp-enforce", true, "Require two-factor authentication for admin and finance permissions")
+
+	flag.StringVar(&cfg.schedule.timezone, "schedule-timezone", "UTC", "Default time zone for lesson schedules")
+
+	flag.StringVar(&cfg.smtp.host, "smtp-host", os.Getenv("SMTP_HOST"), "SMTP host")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 1025, "SMTP port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("SMTP_USERNAME"), "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "CRM <no-reply@crm.local>", "SMTP sender")
+
+	flag.StringVar(&cfg.bootstrapAdmin, "bootstrap-admin", "", "Grant the admin role to the registered user with this email and exit")
 
 	flag.Parse()
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LeverInfo)
 
+	if cfg.argon2.memory > math.MaxUint32 || cfg.argon2.iterations > math.MaxUint32 || cfg.argon2.parallelism > math.MaxUint8 {
+		logger.PrintFatal(errors.New("argon2 flags out of range: memory and iterations must fit in 32 bits, parallelism must be 1-255"), nil)
+	}
+
+	data.PasswordParams.Memory = uint32(cfg.argon2.memory)
+	data.PasswordParams.Iterations = uint32(cfg.argon2.iterations)
+	data.PasswordParams.Parallelism = uint8(cfg.argon2.parallelism)
+
+	err = data.PasswordParams.Validate()
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -72,7 +141,19 @@ func main() {
 		config: cfg,
 		logger: logger,
 		models: data.NewModels(db),
+		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+	}
+
+	if cfg.bootstrapAdmin != "" {
+		err = app.bootstrapAdmin(cfg.bootstrapAdmin)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		return
 	}
+
+	go app.refreshSubscriptionStatuses(time.Hour)
+
 	err = app.serve()
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"authCRM/internal/data"
+	"authCRM/internal/validator"
+	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"golang.org/x/time/rate"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
@@ -67,7 +72,164 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 				}
 			}
 			clients[ip].lastSeen = time.Now()
-			if !clients[ip].limiter.Allow() {
+			limiter := clients[ip].limiter
+
+			// API keys have their own buckets, see rateLimitAPIKey. A request
+			// with a key only needs the IP bucket not to be empty; a token is
+			// taken when the key is rejected, so junk keys are still throttled
+			// by IP.
+			hasKey := r.Header.Get("X-API-Key") != ""
+
+			var allowed bool
+			if hasKey {
+				allowed = limiter.Tokens() >= 1
+			} else {
+				allowed = limiter.Allow()
+			}
+			mu.Unlock()
+
+			if !allowed {
+				app.rateLimitExceededResponse(w, r)
+				return
+			}
+
+			if hasKey {
+				r = app.contextSetIPLimiter(r, limiter)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+		w.Header().Add("Vary", "X-API-Key")
+
+		if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+			app.authenticateAPIKey(w, r, apiKey, next)
+			return
+		}
+
+		authorizationHeader := r.Header.Get("Authorization")
+
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		token := headerParts[1]
+
+		v := validator.New()
+
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = app.models.Tokens.Touch(token, 5*time.Minute)
+		if err != nil {
+			app.logError(r, err)
+		}
+
+		r = app.contextSetUser(r, user)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, plaintext string, next http.Handler) {
+	v := validator.New()
+
+	if data.ValidateAPIKeyPlaintext(v, plaintext); !v.Valid() {
+		app.rejectAPIKey(w, r)
+		return
+	}
+
+	key, user, err := app.models.APIKeys.GetForKey(plaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.rejectAPIKey(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	r = app.contextSetUser(r, user)
+	r = app.contextSetAPIKey(r, key)
+
+	next.ServeHTTP(w, r)
+}
+
+// rejectAPIKey charges a rejected key to the caller's IP bucket, see
+// rateLimit.
+func (app *application) rejectAPIKey(w http.ResponseWriter, r *http.Request) {
+	if limiter := app.contextGetIPLimiter(r); limiter != nil {
+		limiter.Allow()
+	}
+
+	app.invalidAPIKeyResponse(w, r)
+}
+
+func (app *application) rateLimitAPIKey(next http.Handler) http.Handler {
+	type client struct {
+		limiter  *rate.Limiter
+		lastSeen time.Time
+	}
+
+	var (
+		mu      sync.Mutex
+		clients = make(map[uuid.UUID]*client)
+	)
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+
+			mu.Lock()
+
+			for id, client := range clients {
+				if time.Since(client.lastSeen) > 3*time.Minute {
+					delete(clients, id)
+				}
+			}
+
+			mu.Unlock()
+		}
+	}()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := app.contextGetAPIKey(r)
+
+		if app.config.limiter.enabled && key != nil {
+			mu.Lock()
+			if _, found := clients[key.ID]; !found {
+				clients[key.ID] = &client{
+					limiter: rate.NewLimiter(rate.Limit(app.config.limiter.keyRps), app.config.limiter.keyBurst),
+				}
+			}
+			clients[key.ID].lastSeen = time.Now()
+			if !clients[key.ID].limiter.Allow() {
 				mu.Unlock()
 				app.rateLimitExceededResponse(w, r)
 				return
@@ -77,3 +239,92 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if key := app.contextGetAPIKey(r); key != nil && !key.Scopes.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		if app.config.totp.enforce && permissions.RequireTwoFactor() && !user.TOTPEnabled {
+			app.twoFactorRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
+
+// hasPermission reports whether the current user holds the permission and,
+// for requests made with an API key, whether the key's scopes include it.
+func (app *application) hasPermission(r *http.Request, code string) (bool, error) {
+	if key := app.contextGetAPIKey(r); key != nil && !key.Scopes.Include(code) {
+		return false, nil
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		return false, err
+	}
+
+	return permissions.Include(code), nil
+}
+
+// requireBearerToken rejects requests authenticated with an API key, so keys
+// cannot be used to manage credentials of their owner.
+func (app *application) requireBearerToken(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetAPIKey(r) != nil {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return app.requireActivatedUser(fn)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+func (app *application) createPaymentMethodHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name              string   `json:"name"`
+		Active            *bool    `json:"active"`
+		SortOrder         int      `json:"sort_order"`
+		CommissionPercent *float64 `json:"commission_percent"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	pm := &data.PaymentMethod{
+		Name:              input.Name,
+		Active:            true,
+		SortOrder:         input.SortOrder,
+		CommissionPercent: input.CommissionPercent,
+	}
+
+	if input.Active != nil {
+		pm.Active = *input.Active
+	}
+
+	v := validator.New()
+
+	if data.ValidatePaymentMethod(v, pm); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.PaymentMethods.InsertPaymentMethod(pm)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/payment-methods/%s", pm.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"payment_method": pm}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getPaymentMethodHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	pm, err := app.models.PaymentMethods.GetPaymentMethod(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"payment_method": pm}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updatePaymentMethodHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	pm, err := app.models.PaymentMethods.GetPaymentMethod(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name              *string  `json:"name"`
+		Active            *bool    `json:"active"`
+		SortOrder         *int     `json:"sort_order"`
+		CommissionPercent *float64 `json:"commission_percent"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		pm.Name = *input.Name
+	}
+
+	if input.Active != nil {
+		pm.Active = *input.Active
+	}
+
+	if input.SortOrder != nil {
+		pm.SortOrder = *input.SortOrder
+	}
+
+	if input.CommissionPercent != nil {
+		pm.CommissionPercent = input.CommissionPercent
+	}
+
+	v := validator.New()
+
+	v.Check(pm.ArchivedAt == nil || !pm.Active, "active", "архивный способ оплаты нельзя включить")
+
+	if data.ValidatePaymentMethod(v, pm); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.PaymentMethods.UpdatePaymentMethod(pm)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"payment_method": pm}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deletePaymentMethodHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	archived, err := app.models.PaymentMethods.DeletePaymentMethod(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	message := "успешно удалено"
+	if archived {
+		message = "по способу оплаты есть операции, он перенесен в архив"
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listPaymentMethodsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Active          *bool
+		IncludeArchived *bool
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Active = app.readBool(qs, "active", v)
+	input.IncludeArchived = app.readBool(qs, "include_archived", v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "sort_order")
+	input.Filters.SortSafelist = []string{"sort_order", "name", "created_at", "-sort_order", "-name", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	includeArchived := input.IncludeArchived != nil && *input.IncludeArchived
+
+	methods, metadata, err := app.models.PaymentMethods.GetAllPaymentMethods(input.Active, includeArchived, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"payment_methods": methods, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/validator"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+func (app *application) createPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Amount          int64      `json:"amount"`
+		PaymentMethodID uuid.UUID  `json:"payment_method_id"`
+		CategoryID      *uuid.UUID `json:"category_id"`
+		Date            *time.Time `json:"date"`
+		Comment         string     `json:"comment"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ss, err := app.models.StudentSubscriptions.GetStudentSubscription(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	payment := &data.Payment{
+		StudentSubscriptionID: ss.ID,
+		Amount:                input.Amount,
+		PaymentMethodID:       input.PaymentMethodID,
+		Date:                  dateOrToday(input.Date),
+		Comment:               input.Comment,
+		CreatedBy:             &user.ID,
+	}
+
+	categoryID := data.SubscriptionIncomeCategoryID
+	if input.CategoryID != nil {
+		categoryID = *input.CategoryID
+	}
+
+	v := validator.New()
+
+	if data.ValidatePayment(v, payment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkCategory(w, r, v, data.CategoryIncome, categoryID) || !app.checkPaymentMethod(w, r, v, payment.PaymentMethodID) {
+		return
+	}
+
+	err = app.models.Payments.InsertPayment(payment, categoryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrAlreadyCancelled):
+			app.errorResponse(w, r, http.StatusConflict, "подписка отменена, оплаты по ней закрыты")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	balance, err := app.models.Payments.GetBalance(payment.StudentID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/student-subscription/%s/payments", payment.StudentSubscriptionID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"payment": payment, "balance": balance}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	payments, err := app.models.Payments.GetAllForSubscription(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"payments": payments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deletePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Payments.DeletePayment(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrAlreadyCancelled):
+			app.errorResponse(w, r, http.StatusConflict, "подписка отменена, оплаты по ней закрыты")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "успешно удалено"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) studentBalanceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Students.GetStudent(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	balance, err := app.models.Payments.GetBalance(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"balance": balance}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listDebtorsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-debt")
+	input.Filters.SortSafelist = []string{"debt", "days_overdue", "-debt", "-days_overdue"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	debtors, metadata, err := app.models.Payments.GetDebtors(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"debtors": debtors, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/validator"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+func (app *application) createPayrollHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	payroll := &data.Payroll{
+		From:      data.TruncateToDate(input.From),
+		To:        data.TruncateToDate(input.To),
+		CreatedBy: &user.ID,
+	}
+
+	v := validator.New()
+
+	if data.ValidatePayrollPeriod(v, payroll.From, payroll.To); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Payrolls.CreatePayroll(payroll)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPayrollOverlap):
+			v.AddError("from", "период пересекается с проведённой ведомостью")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/payrolls/%s", payroll.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"payroll": payroll}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getPayrollHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	payroll, err := app.models.Payrolls.GetPayroll(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"payroll": payroll}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listPayrollsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Status *data.PayrollStatus
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	if status := data.PayrollStatus(app.readString(qs, "status", "")); status != "" {
+		v.Check(validator.PermittedValue(status, data.PayrollDraft, data.PayrollPosted), "status", "неверный статус ведомости")
+		input.Status = &status
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-period_from")
+	input.Filters.SortSafelist = []string{"period_from", "created_at", "total", "-period_from", "-created_at", "-total"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	payrolls, metadata, err := app.models.Payrolls.GetAllPayrolls(input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"payrolls": payrolls, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deletePayrollHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Payrolls.DeletePayroll(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrPayrollPosted):
+			app.errorResponse(w, r, http.StatusConflict, "проведённую ведомость нельзя удалить")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "успешно удалено"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// approvePayrollHandler approves a draft payroll and posts the pay of every
+// teacher to the ledger as an expense paid with the given method.
+func (app *application) approvePayrollHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		PaymentMethodID uuid.UUID  `json:"payment_method_id"`
+		CategoryID      *uuid.UUID `json:"category_id"`
+		Version         *int       `json:"version"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	payroll, err := app.models.Payrolls.GetPayroll(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.Version != nil && *input.Version != payroll.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	categoryID := data.SalaryExpenseCategoryID
+	if input.CategoryID != nil {
+		categoryID = *input.CategoryID
+	}
+
+	v := validator.New()
+
+	v.Check(input.PaymentMethodID != uuid.Nil, "payment_method_id", "должны указать способ оплаты!")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkCategory(w, r, v, data.CategoryExpense, categoryID) || !app.checkPaymentMethod(w, r, v, input.PaymentMethodID) {
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Payrolls.PostPayroll(payroll, input.PaymentMethodID, categoryID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrPayrollPosted):
+			app.errorResponse(w, r, http.StatusConflict, "ведомость уже проведена")
+		case errors.Is(err, data.ErrPayrollOverlap):
+			app.errorResponse(w, r, http.StatusConflict, "период пересекается с проведённой ведомостью")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"payroll": payroll}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"authCRM/internal/data"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
 )
@@ -12,25 +13,129 @@ func (app *application) routes() http.Handler {
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthCheckHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/teacher", app.createTeacherHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/teacher/:id", app.getTeacherHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/teacher/:id", app.updateTeacherHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/teacher/:id", app.deleteTeacherHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/teachers", app.listTeachersHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/teacher", app.requirePermission("teachers:write", app.createTeacherHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/teacher/:id", app.requirePermission("teachers:read", app.getTeacherHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/teacher/:id", app.requirePermission("teachers:write", app.updateTeacherHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/teacher/:id", app.requirePermission("teachers:write", app.deleteTeacherHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/teachers", app.requirePermission("teachers:read", app.listTeachersHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/student", app.requirePermission("students:write", app.createStudentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/student/:id", app.requirePermission("students:read", app.getStudentHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/student/:id", app.requirePermission("students:write", app.updateStudentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/student/:id", app.requirePermission("students:write", app.deleteStudentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/students", app.requirePermission("students:read", app.listStudentsHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/student/:id/subscriptions", app.requirePermission("students:write", app.sellSubscriptionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/student/:id/subscriptions", app.requirePermission("students:read", app.listStudentSubscriptionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/student-subscription/:id", app.requirePermission("students:read", app.getStudentSubscriptionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/student-subscription/:id/freezes", app.requirePermission("students:write", app.createFreezeHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/student-subscription/:id/freezes", app.requirePermission("students:read", app.listFreezesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/student-subscription/:id/payments", app.requirePermission("finance:write", app.createPaymentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/student-subscription/:id/payments", app.requirePermission("finance:read", app.listPaymentsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/payments/:id", app.requirePermission("finance:write", app.deletePaymentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/student-subscription/:id/refund-quote", app.requirePermission("finance:read", app.refundQuoteHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/student-subscription/:id/cancel", app.requirePermission("finance:write", app.cancelSubscriptionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/student-subscription/:id/cancellation", app.requirePermission("finance:read", app.getCancellationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/students/:id/balance", app.requirePermission("finance:read", app.studentBalanceHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/debtors", app.requirePermission("finance:read", app.listDebtorsHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/group", app.requirePermission("groups:write", app.createGroupHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/group/:id", app.requirePermission("groups:read", app.getGroupHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/group/:id", app.requirePermission("groups:write", app.updateGroupHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/group/:id", app.requirePermission("groups:write", app.deleteGroupHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/groups", app.requirePermission("groups:read", app.listGroupsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/group/:id/students", app.requirePermission("groups:read", app.listGroupStudentsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/group/:id/students", app.requirePermission("groups:write", app.enrollStudentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/group/:id/students/:student_id", app.requirePermission("groups:write", app.unenrollStudentHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/group/:id/transfer", app.requirePermission("groups:write", app.transferStudentHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/group/:id/schedules", app.requirePermission("groups:write", app.createScheduleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/group/:id/schedules", app.requirePermission("groups:read", app.listSchedulesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/schedule/:id", app.requirePermission("groups:read", app.getScheduleHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/schedule/:id", app.requirePermission("groups:write", app.updateScheduleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/schedule/:id", app.requirePermission("groups:write", app.deleteScheduleHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/schedule/:id/exceptions", app.requirePermission("groups:write", app.createScheduleExceptionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/lessons/generate", app.requirePermission("groups:write", app.generateLessonsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/lesson", app.requirePermission("groups:write", app.createLessonHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/lesson/:id", app.requirePermission("groups:read", app.getLessonHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/lesson/:id", app.requirePermission("groups:write", app.updateLessonHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/lessons", app.requirePermission("groups:read", app.listLessonsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/lesson/:id/attendance", app.requirePermission("attendance:write", app.markAttendanceHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/lesson/:id/attendance", app.requirePermission("groups:read", app.listAttendanceHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/lesson/:id/attendance/:student_id", app.requirePermission("attendance:write", app.deleteAttendanceHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/user", app.registerUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/2fa", app.requireBearerToken(app.enrollTwoFactorHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/2fa", app.requireBearerToken(app.confirmTwoFactorHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/2fa", app.requireBearerToken(app.disableTwoFactorHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", app.requireBearerToken(app.listSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", app.requireBearerToken(app.deleteSessionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users", app.requirePermission("users:read", app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/user/:id", app.requirePermission("users:read", app.getUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/user/:id", app.requirePermission("users:write", app.updateUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/user/:id/role", app.requirePermission("users:write", app.grantRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/user/:id/role", app.requirePermission("users:write", app.revokeRoleHandler))
+
+	router.HandlerFunc(http.MethodDelete, "/v1/user/:id/sessions", app.requirePermission("users:write", app.deleteUserSessionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/user/:id/lockouts", app.requirePermission("users:read", app.listUserLockoutsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/user/:id/lockouts", app.requirePermission("users:write", app.unlockUserHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/api-keys", app.requireBearerToken(app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/api-keys", app.requireBearerToken(app.createAPIKeyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/api-keys/:id", app.requireBearerToken(app.revokeAPIKeyHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/cabinet/:id", app.requirePermission("cabinets:read", app.getCabinetHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/cabinet", app.requirePermission("cabinets:write", app.createCabinetHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/cabinet/:id", app.requirePermission("cabinets:write", app.updateCabinetHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/cabinet/:id", app.requirePermission("cabinets:write", app.deleteCabinetHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/cabinets", app.requirePermission("cabinets:read", app.listCabinetsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/cabinets/:id/availability", app.requirePermission("cabinets:read", app.cabinetAvailabilityHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/subscription/:id", app.requirePermission("subscriptions:read", app.getSubHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/subscription/", app.requirePermission("subscriptions:write", app.createSubHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/subscription/:id", app.requirePermission("subscriptions:write", app.updateSubHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/subscription/:id", app.requirePermission("subscriptions:write", app.deleteSubscriptionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/subscription/:id/restore", app.requirePermission("subscriptions:write", app.restoreSubscriptionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/subscriptions", app.requirePermission("subscriptions:read", app.listSubscriptionsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/payment-methods", app.requirePermission("finance:read", app.listPaymentMethodsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/payment-methods", app.requirePermission("finance:write", app.createPaymentMethodHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/payment-methods/:id", app.requirePermission("finance:read", app.getPaymentMethodHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/payment-methods/:id", app.requirePermission("finance:write", app.updatePaymentMethodHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/payment-methods/:id", app.requirePermission("finance:write", app.deletePaymentMethodHandler))
+
+	for _, kind := range []data.CategoryKind{data.CategoryIncome, data.CategoryExpense} {
+		router.HandlerFunc(http.MethodGet, categoryPath(kind), app.requirePermission("finance:read", app.listCategoriesHandler(kind)))
+		router.HandlerFunc(http.MethodPost, categoryPath(kind), app.requirePermission("finance:write", app.createCategoryHandler(kind)))
+		router.HandlerFunc(http.MethodGet, categoryPath(kind)+"/:id", app.requirePermission("finance:read", app.getCategoryHandler(kind)))
+		router.HandlerFunc(http.MethodPatch, categoryPath(kind)+"/:id", app.requirePermission("finance:write", app.updateCategoryHandler(kind)))
+		router.HandlerFunc(http.MethodDelete, categoryPath(kind)+"/:id", app.requirePermission("finance:write", app.deleteCategoryHandler(kind)))
+	}
+
+	router.HandlerFunc(http.MethodGet, "/v1/transactions", app.requirePermission("finance:read", app.listTransactionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/transactions", app.requirePermission("finance:write", app.createTransactionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/transactions/:id", app.requirePermission("finance:read", app.getTransactionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/transactions/:id", app.requirePermission("finance:write", app.deleteTransactionHandler))
 
-	router.HandlerFunc(http.MethodGet, "/v1/cabinet/:id", app.getCabinetHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/cabinet", app.createCabinetHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/cabinet/:id", app.updateCabinetHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/cabinet/:id", app.deleteCabinetHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/cabinets", app.listCabinetsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/salary-rates", app.requirePermission("finance:read", app.listSalaryRatesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/salary-rates", app.requirePermission("finance:write", app.createSalaryRateHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/salary-rates/:id", app.requirePermission("finance:read", app.getSalaryRateHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/salary-rates/:id", app.requirePermission("finance:write", app.updateSalaryRateHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/salary-rates/:id", app.requirePermission("finance:write", app.deleteSalaryRateHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/teacher/:id/salary-rates", app.requirePermission("finance:read", app.listTeacherSalaryRatesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/teacher/:id/salary-rates", app.requirePermission("finance:write", app.assignSalaryRateHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/teacher/:id/salary-rates/:assignment_id", app.requirePermission("finance:write", app.deleteTeacherSalaryRateHandler))
 
-	router.HandlerFunc(http.MethodGet, "/v1/subscription/:id", app.getSubHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/subscription/", app.createSubHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/subscription/:id", app.updateSubHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/subscription/:id", app.deleteSubscriptionHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/subscriptions", app.listSubscriptionsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/payrolls", app.requirePermission("finance:read", app.listPayrollsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/payrolls", app.requirePermission("finance:write", app.createPayrollHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/payrolls/:id", app.requirePermission("finance:read", app.getPayrollHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/payrolls/:id", app.requirePermission("finance:write", app.deletePayrollHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/payrolls/:id/approve", app.requirePermission("finance:write", app.approvePayrollHandler))
 
-	return app.recoverPanic(app.rateLimit(router))
+	return app.recoverPanic(app.rateLimit(app.authenticate(app.rateLimitAPIKey(router))))
 }
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/validator"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+func (app *application) createSalaryRateHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name    string            `json:"name"`
+		Scheme  data.SalaryScheme `json:"scheme"`
+		Amount  *int64            `json:"amount"`
+		Percent *float64          `json:"percent"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	sr := &data.SalaryRate{
+		Name:    input.Name,
+		Scheme:  input.Scheme,
+		Amount:  input.Amount,
+		Percent: input.Percent,
+	}
+
+	v := validator.New()
+
+	if data.ValidateSalaryRate(v, sr); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.SalaryRates.InsertSalaryRate(sr)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/salary-rates/%s", sr.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"salary_rate": sr}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getSalaryRateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	sr, err := app.models.SalaryRates.GetSalaryRate(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"salary_rate": sr}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateSalaryRateHandler patches a rate. Switching between the revenue
+// share and the other schemes also means sending the matching amount or
+// percent; the one that no longer applies is cleared.
+func (app *application) updateSalaryRateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	sr, err := app.models.SalaryRates.GetSalaryRate(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name    *string            `json:"name"`
+		Scheme  *data.SalaryScheme `json:"scheme"`
+		Amount  *int64             `json:"amount"`
+		Percent *float64           `json:"percent"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		sr.Name = *input.Name
+	}
+
+	if input.Scheme != nil {
+		sr.Scheme = *input.Scheme
+	}
+
+	if input.Amount != nil {
+		sr.Amount = input.Amount
+	}
+
+	if input.Percent != nil {
+		sr.Percent = input.Percent
+	}
+
+	if sr.Scheme == data.SalaryRevenueShare {
+		sr.Amount = nil
+	} else {
+		sr.Percent = nil
+	}
+
+	v := validator.New()
+
+	if data.ValidateSalaryRate(v, sr); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.SalaryRates.UpdateSalaryRate(sr)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"salary_rate": sr}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSalaryRateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.SalaryRates.DeleteSalaryRate(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrSalaryRateInUse):
+			app.errorResponse(w, r, http.StatusConflict, "ставка назначена преподавателям")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "успешно удалено"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSalaryRatesHandler(w http.ResponseWriter, r *http.Request) {
+	rates, err := app.models.SalaryRates.GetAllSalaryRates()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"salary_rates": rates}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) assignSalaryRateHandler(w http.ResponseWriter, r *http.Request) {
+	teacherID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		SalaryRateID  uuid.UUID  `json:"salary_rate_id"`
+		EffectiveFrom *time.Time `json:"effective_from"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	teacher, err := app.models.Teachers.GetTeacher(teacherID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a := &data.TeacherSalaryRate{
+		TeacherID:     teacher.ID,
+		SalaryRateID:  input.SalaryRateID,
+		EffectiveFrom: dateOrToday(input.EffectiveFrom),
+	}
+
+	v := validator.New()
+
+	if data.ValidateTeacherSalaryRate(v, a); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	sr, err := app.models.SalaryRates.GetSalaryRate(a.SalaryRateID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("salary_rate_id", "ставка не найдена")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.Name = sr.Name
+	a.Scheme = sr.Scheme
+
+	err = app.models.SalaryRates.AssignSalaryRate(a)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRateStart):
+			v.AddError("effective_from", "с этой даты уже назначена ставка")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/teacher/%s/salary-rates", teacher.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"teacher_salary_rate": a}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listTeacherSalaryRatesHandler(w http.ResponseWriter, r *http.Request) {
+	teacherID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	assignments, err := app.models.SalaryRates.GetAssignments(teacherID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"teacher_salary_rates": assignments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTeacherSalaryRateHandler(w http.ResponseWriter, r *http.Request) {
+	teacherID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	id, err := app.readUUIDParam(r, "assignment_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.SalaryRates.DeleteAssignment(teacherID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "успешно удалено"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
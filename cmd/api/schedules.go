@@ -0,0 +1,414 @@
+package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/validator"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+func (app *application) createScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	group, err := app.models.Groups.GetGroup(groupID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		TeacherID     *uuid.UUID  `json:"teacher_id"`
+		CabinetID     *uuid.UUID  `json:"cabinet_id"`
+		Weekdays      []int32     `json:"weekdays"`
+		StartTime     string      `json:"start_time"`
+		EndTime       string      `json:"end_time"`
+		IntervalWeeks int         `json:"interval_weeks"`
+		Timezone      string      `json:"timezone"`
+		StartsOn      *time.Time  `json:"starts_on"`
+		Until         *time.Time  `json:"until"`
+		Exceptions    []time.Time `json:"exceptions"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	schedule := &data.Schedule{
+		GroupID:       group.ID,
+		TeacherID:     group.TeacherID,
+		CabinetID:     group.CabinetID,
+		Weekdays:      input.Weekdays,
+		StartTime:     input.StartTime,
+		EndTime:       input.EndTime,
+		IntervalWeeks: input.IntervalWeeks,
+		Timezone:      input.Timezone,
+		StartsOn:      group.StartDate,
+		Until:         group.EndDate,
+		Exceptions:    []time.Time{},
+	}
+
+	if input.TeacherID != nil {
+		schedule.TeacherID = input.TeacherID
+	}
+
+	if input.CabinetID != nil {
+		schedule.CabinetID = input.CabinetID
+	}
+
+	if schedule.IntervalWeeks == 0 {
+		schedule.IntervalWeeks = 1
+	}
+
+	if schedule.Timezone == "" {
+		schedule.Timezone = app.config.schedule.timezone
+	}
+
+	if input.StartsOn != nil {
+		schedule.StartsOn = data.TruncateToDate(*input.StartsOn)
+	}
+
+	if input.Until != nil {
+		until := data.TruncateToDate(*input.Until)
+		schedule.Until = &until
+	}
+
+	for _, date := range input.Exceptions {
+		schedule.Exceptions = append(schedule.Exceptions, data.TruncateToDate(date))
+	}
+
+	v := validator.New()
+
+	if data.ValidateSchedule(v, schedule); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkTeacherAndCabinet(w, r, v, schedule.TeacherID, schedule.CabinetID) {
+		return
+	}
+
+	err = app.models.Schedules.InsertSchedule(schedule)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/schedule/%s", schedule.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"schedule": schedule}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	schedules, err := app.models.Schedules.GetAllForGroup(groupID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"schedules": schedules}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	schedule, err := app.models.Schedules.GetSchedule(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"schedule": schedule}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateScheduleHandler edits the whole rule, or with "from" set, only this
+// and the following lessons: the rule is split in two at that date.
+func (app *application) updateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	schedule, err := app.models.Schedules.GetSchedule(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		TeacherID     *uuid.UUID `json:"teacher_id"`
+		CabinetID     *uuid.UUID `json:"cabinet_id"`
+		Weekdays      []int32    `json:"weekdays"`
+		StartTime     *string    `json:"start_time"`
+		EndTime       *string    `json:"end_time"`
+		IntervalWeeks *int       `json:"interval_weeks"`
+		Timezone      *string    `json:"timezone"`
+		StartsOn      *time.Time `json:"starts_on"`
+		Until         *time.Time `json:"until"`
+		From          *time.Time `json:"from"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	updated := *schedule
+
+	if input.TeacherID != nil {
+		updated.TeacherID = input.TeacherID
+	}
+
+	if input.CabinetID != nil {
+		updated.CabinetID = input.CabinetID
+	}
+
+	if input.Weekdays != nil {
+		updated.Weekdays = input.Weekdays
+	}
+
+	if input.StartTime != nil {
+		updated.StartTime = *input.StartTime
+	}
+
+	if input.EndTime != nil {
+		updated.EndTime = *input.EndTime
+	}
+
+	if input.IntervalWeeks != nil {
+		updated.IntervalWeeks = *input.IntervalWeeks
+	}
+
+	if input.Timezone != nil {
+		updated.Timezone = *input.Timezone
+	}
+
+	if input.StartsOn != nil {
+		updated.StartsOn = data.TruncateToDate(*input.StartsOn)
+	}
+
+	if input.Until != nil {
+		until := data.TruncateToDate(*input.Until)
+		updated.Until = &until
+	}
+
+	split := input.From != nil && data.TruncateToDate(*input.From).After(schedule.StartsOn)
+
+	v := validator.New()
+
+	if split {
+		from := data.TruncateToDate(*input.From)
+		v.Check(input.StartsOn == nil, "starts_on", "при изменении с даты начало правила задаётся полем from")
+		if schedule.Until != nil {
+			v.Check(!from.After(*schedule.Until), "from", "дата позже окончания расписания")
+		}
+		updated.StartsOn = from
+	}
+
+	if data.ValidateSchedule(v, &updated); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkTeacherAndCabinet(w, r, v, updated.TeacherID, updated.CabinetID) {
+		return
+	}
+
+	var result *data.GenerationResult
+	if split {
+		result, err = app.models.Schedules.SplitSchedule(schedule, &updated, updated.StartsOn)
+	} else {
+		result, err = app.models.Schedules.UpdateSchedule(&updated, data.TruncateToDate(time.Now()))
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{"schedule": &updated, "skipped": result.Skipped}
+	if split {
+		env["previous_schedule"] = schedule
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteScheduleHandler removes the rule, or with ?from=YYYY-MM-DD ends it
+// the day before, keeping the lessons that came earlier.
+func (app *application) deleteScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	from := app.readDate(r.URL.Query(), "from", v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	schedule, err := app.models.Schedules.GetSchedule(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Schedules.DeleteSchedule(schedule, from)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "успешно удалено"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createScheduleExceptionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Date time.Time `json:"date"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(!input.Date.IsZero(), "date", "должны указать дату!")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	schedule, err := app.models.Schedules.GetSchedule(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Schedules.AddException(schedule, data.TruncateToDate(input.Date))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"schedule": schedule}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) generateLessonsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		From    time.Time  `json:"from"`
+		To      time.Time  `json:"to"`
+		GroupID *uuid.UUID `json:"group_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	from, to := data.TruncateToDate(input.From), data.TruncateToDate(input.To)
+
+	v := validator.New()
+
+	if data.ValidateGenerationRange(v, from, to); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	result, err := app.models.Schedules.Generate(from, to, input.GroupID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"created": result.Created, "skipped": result.Skipped}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
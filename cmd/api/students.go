@@ -1 +1,239 @@
 package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+func (app *application) createStudentHandler(w http.ResponseWriter, r *http.Request) {
+	var studentInput struct {
+		FullName    string      `json:"full_name"`
+		Gender      data.Gender `json:"gender"`
+		Phone       string      `json:"phone"`
+		ParentPhone string      `json:"parent_phone"`
+		Note        string      `json:"note"`
+	}
+
+	err := app.readJSON(w, r, &studentInput)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	student := &data.Student{
+		FullName:    studentInput.FullName,
+		Gender:      studentInput.Gender,
+		Phone:       studentInput.Phone,
+		ParentPhone: studentInput.ParentPhone,
+		Note:        studentInput.Note,
+		Status:      data.StudentActive,
+	}
+
+	if student.Gender == "" {
+		student.Gender = data.Male
+	}
+
+	v := validator.New()
+
+	if data.ValidateStudent(v, student); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Students.InsertStudent(student)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/student/%s", student.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"student": student}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getStudentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	student, err := app.models.Students.GetStudent(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"student": student}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateStudentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	student, err := app.models.Students.GetStudent(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var studentInput struct {
+		FullName    *string             `json:"full_name"`
+		Gender      *data.Gender        `json:"gender"`
+		Phone       *string             `json:"phone"`
+		ParentPhone *string             `json:"parent_phone"`
+		Status      *data.StudentStatus `json:"status"`
+		Note        *string             `json:"note"`
+	}
+
+	err = app.readJSON(w, r, &studentInput)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if studentInput.FullName != nil {
+		student.FullName = *studentInput.FullName
+	}
+
+	if studentInput.Gender != nil {
+		student.Gender = *studentInput.Gender
+	}
+
+	if studentInput.Phone != nil {
+		student.Phone = *studentInput.Phone
+	}
+
+	if studentInput.ParentPhone != nil {
+		student.ParentPhone = *studentInput.ParentPhone
+	}
+
+	if studentInput.Status != nil {
+		student.Status = *studentInput.Status
+	}
+
+	if studentInput.Note != nil {
+		student.Note = *studentInput.Note
+	}
+
+	v := validator.New()
+
+	if data.ValidateStudent(v, student); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Students.UpdateStudent(student)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"student": student}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteStudentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Students.DeleteStudent(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrStudentHasSubscriptions):
+			app.errorResponse(w, r, http.StatusConflict, "у студента есть абонементы, его нельзя удалить")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "успешно удалено"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listStudentsHandler(w http.ResponseWriter, r *http.Request) {
+	var studentInput struct {
+		Search        string
+		StudentStatus data.StudentStatus
+		Gender        data.Gender
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	studentInput.Search = app.readString(qs, "search", "")
+	studentInput.StudentStatus = app.readStudentStatus(qs, "status", "")
+	studentInput.Gender = app.readGender(qs, "gender", "")
+
+	studentInput.Filters.Page = app.readInt(qs, "page", 1, v)
+	studentInput.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	studentInput.Filters.Sort = app.readString(qs, "sort", "id")
+	studentInput.Filters.SortSafelist = []string{"id", "full_name", "status", "created_at", "-id", "-full_name", "-status", "-created_at"}
+
+	if data.ValidateFilters(v, studentInput.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var gender *data.Gender
+	if studentInput.Gender != "" {
+		gender = &studentInput.Gender
+	}
+
+	var status *data.StudentStatus
+	if studentInput.StudentStatus != "" {
+		status = &studentInput.StudentStatus
+	}
+
+	students, metadata, err := app.models.Students.GetAllStudents(studentInput.Search, gender, status, studentInput.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"students": students, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
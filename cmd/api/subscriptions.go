@@ -16,6 +16,7 @@ func (app *application) createSubHandler(w http.ResponseWriter, r *http.Request)
 		DurationMonths *int16         `json:"duration_months,omitempty"`
 		SessionsCount  *int16         `json:"sessions_count,omitempty"`
 		ValidityMonths *int16         `json:"validity_months,omitempty"`
+		MaxFreezeDays  *int16         `json:"max_freeze_days,omitempty"`
 	}
 
 	err := app.readJSON(w, r, &subInput)
@@ -31,6 +32,7 @@ func (app *application) createSubHandler(w http.ResponseWriter, r *http.Request)
 		DurationMonths: subInput.DurationMonths,
 		SessionsCount:  subInput.SessionsCount,
 		ValidityMonths: subInput.ValidityMonths,
+		MaxFreezeDays:  subInput.MaxFreezeDays,
 	}
 
 	v := validator.New()
@@ -105,6 +107,7 @@ func (app *application) updateSubHandler(w http.ResponseWriter, r *http.Request)
 		DurationMonths *int16          `json:"duration_months,omitempty"`
 		SessionsCount  *int16          `json:"sessions_count,omitempty"`
 		ValidityMonths *int16          `json:"validity_months,omitempty"`
+		MaxFreezeDays  *int16          `json:"max_freeze_days,omitempty"`
 	}
 
 	err = app.readJSON(w, r, &subinput)
@@ -137,6 +140,10 @@ func (app *application) updateSubHandler(w http.ResponseWriter, r *http.Request)
 		sub.ValidityMonths = subinput.ValidityMonths
 	}
 
+	if subinput.MaxFreezeDays != nil {
+		sub.MaxFreezeDays = subinput.MaxFreezeDays
+	}
+
 	v := validator.New()
 
 	if data.ValidateSubscription(v, sub); !v.Valid() {
@@ -161,37 +168,144 @@ func (app *application) updateSubHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// deleteSubscriptionHandler archives the plan. With ?hard=true it is deleted
+// for good instead, which is only allowed for plans that were never sold.
 func (app *application) deleteSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	hard := app.readBool(r.URL.Query(), "hard", v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 
-	err = app.models.Subscriptions.DeleteSubscription(id)
+	if hard != nil && *hard {
+		err = app.models.Subscriptions.DeleteSubscription(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			case errors.Is(err, data.ErrSubscriptionSold):
+				app.errorResponse(w, r, http.StatusConflict, "подписка уже продавалась, её можно только архивировать")
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"message": "успешно удалено"}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	sub := &data.Subscription{ID: id}
+
+	err = app.models.Subscriptions.ArchiveSubscription(sub)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "подписка перенесена в архив", "archived_at": sub.ArchivedAt}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) restoreSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
 
+	sub, err := app.models.Subscriptions.GetSubscription(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Subscriptions.RestoreSubscription(sub)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "успешно удалено"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"subscription": sub}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) listSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.SubscriptionFilter
+		data.Filters
+	}
 
-	subs, err := app.models.Subscriptions.GetAllSubscriptions()
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.SubscriptionFilter.Name = app.readString(qs, "name", "")
+
+	if subType := data.SubStatus(app.readString(qs, "type", "")); subType != "" {
+		v.Check(validator.PermittedValue(subType, data.Monthly, data.Visits), "type", "тип: период или количество")
+		input.SubscriptionFilter.Type = &subType
+	}
+
+	input.SubscriptionFilter.MinPrice = app.readPrice(qs, "min_price", v)
+	input.SubscriptionFilter.MaxPrice = app.readPrice(qs, "max_price", v)
+
+	if input.SubscriptionFilter.MinPrice != nil && input.SubscriptionFilter.MaxPrice != nil {
+		v.Check(*input.SubscriptionFilter.MinPrice <= *input.SubscriptionFilter.MaxPrice, "max_price", "максимальная цена меньше минимальной")
+	}
+
+	includeArchived := app.readBool(qs, "include_archived", v)
+	input.SubscriptionFilter.IncludeArchived = includeArchived != nil && *includeArchived
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "name")
+	input.Filters.SortSafelist = []string{"name", "price", "created_at", "-name", "-price", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	subs, metadata, err := app.models.Subscriptions.GetAllSubscriptions(input.SubscriptionFilter, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"subscriptions": subs}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"subscriptions": subs, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
-
 }
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/validator"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		OTP      string `json:"otp"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateEmail(v, input.Email)
+	data.ValidatePasswordPlaintext(v, input.Password)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	policy := app.lockoutPolicy()
+
+	if retryAfter := policy.RetryAfter(user, time.Now()); retryAfter > 0 {
+		app.logger.PrintInfo("login throttled", map[string]string{
+			"email_hash":  hashEmail(user.Email),
+			"retry_after": retryAfter.String(),
+		})
+		app.loginThrottledResponse(w, r, retryAfter)
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if match && user.TOTPEnabled {
+		if input.OTP == "" {
+			app.twoFactorCodeRequiredResponse(w, r)
+			return
+		}
+
+		match, err = app.checkSecondFactor(user, input.OTP)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if !match {
+		lockout, err := app.models.Lockouts.RecordFailure(user, policy)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.logger.PrintInfo("login failed", map[string]string{
+			"email_hash": hashEmail(user.Email),
+			"attempts":   strconv.Itoa(user.FailedLoginAttempts),
+		})
+
+		if lockout != nil {
+			app.logger.PrintInfo("account locked", map[string]string{
+				"email_hash":   hashEmail(user.Email),
+				"locked_until": lockout.LockedUntil.UTC().Format(time.RFC3339),
+			})
+			app.loginThrottledResponse(w, r, time.Until(lockout.LockedUntil))
+			return
+		}
+
+		if retryAfter := policy.RetryAfter(user, time.Now()); retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		}
+
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	if user.Password.NeedsRehash() {
+		err = user.Password.Set(input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.models.Users.UpdateUser(user)
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+
+	if user.FailedLoginAttempts > 0 || user.LockedUntil != nil {
+		err = app.models.Lockouts.Reset(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	token, err := app.models.Tokens.NewSession(user.ID, 24*time.Hour, app.clientIP(r), r.UserAgent())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no matching email address found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !user.Activated {
+		v.AddError("email", "user account must be activated")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	lang := app.readLanguage(r)
+
+	app.background(func() {
+		mailData := map[string]any{
+			"passwordResetToken": token.Plaintext,
+		}
+
+		err := app.mailer.Send(user.Email, lang, "token_password_reset.tmpl", mailData)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	env := envelope{"message": "an email will be sent to you containing password reset instructions"}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
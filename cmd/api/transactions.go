@@ -0,0 +1,230 @@
+package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/validator"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+func (app *application) createTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Direction       data.TransactionDirection `json:"direction"`
+		Amount          int64                     `json:"amount"`
+		CategoryID      uuid.UUID                 `json:"category_id"`
+		PaymentMethodID uuid.UUID                 `json:"payment_method_id"`
+		Date            *time.Time                `json:"date"`
+		Comment         string                    `json:"comment"`
+		StudentID       *uuid.UUID                `json:"student_id"`
+		TeacherID       *uuid.UUID                `json:"teacher_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	t := &data.Transaction{
+		Direction:       input.Direction,
+		Amount:          input.Amount,
+		CategoryID:      input.CategoryID,
+		PaymentMethodID: input.PaymentMethodID,
+		Date:            dateOrToday(input.Date),
+		Comment:         input.Comment,
+		StudentID:       input.StudentID,
+		TeacherID:       input.TeacherID,
+		CreatedBy:       &user.ID,
+	}
+
+	v := validator.New()
+
+	if data.ValidateTransaction(v, t); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	kind := data.CategoryIncome
+	if t.Direction == data.Expense {
+		kind = data.CategoryExpense
+	}
+
+	if !app.checkCategory(w, r, v, kind, t.CategoryID) || !app.checkPaymentMethod(w, r, v, t.PaymentMethodID) {
+		return
+	}
+
+	if t.StudentID != nil {
+		_, err = app.models.Students.GetStudent(*t.StudentID)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			v.AddError("student_id", "студент не найден")
+		}
+	}
+
+	if !app.checkTeacherAndCabinet(w, r, v, t.TeacherID, nil) {
+		return
+	}
+
+	err = app.models.Transactions.InsertTransaction(t)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/transactions/%s", t.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"transaction": t}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	t, err := app.models.Transactions.GetTransaction(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"transaction": t}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Transactions.DeleteTransaction(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrTransactionLinked):
+			app.errorResponse(w, r, http.StatusConflict, "операция создана платежом, её нельзя удалить отдельно")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "успешно удалено"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.TransactionFilter
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.TransactionFilter.From = app.readDate(qs, "from", v)
+	input.TransactionFilter.To = app.readDate(qs, "to", v)
+	input.TransactionFilter.CategoryID = app.readUUID(qs, "category_id", v)
+	input.TransactionFilter.PaymentMethodID = app.readUUID(qs, "payment_method_id", v)
+	input.TransactionFilter.StudentID = app.readUUID(qs, "student_id", v)
+	input.TransactionFilter.TeacherID = app.readUUID(qs, "teacher_id", v)
+
+	if direction := data.TransactionDirection(app.readString(qs, "direction", "")); direction != "" {
+		v.Check(validator.PermittedValue(direction, data.Income, data.Expense), "direction", "направление: приход или расход")
+		input.TransactionFilter.Direction = &direction
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-date")
+	input.Filters.SortSafelist = []string{"date", "amount", "created_at", "-date", "-amount", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	transactions, metadata, err := app.models.Transactions.GetAllTransactions(input.TransactionFilter, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	totals, err := app.models.Transactions.GetTotals(input.TransactionFilter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"transactions": transactions, "totals": totals, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) checkCategory(w http.ResponseWriter, r *http.Request, v *validator.Validator, kind data.CategoryKind, id uuid.UUID) bool {
+	_, err := app.models.Categories.GetCategory(kind, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("category_id", "статья не найдена")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	return true
+}
+
+// checkPaymentMethod only lets new money movements use active methods;
+// archived and switched off ones stay for history.
+func (app *application) checkPaymentMethod(w http.ResponseWriter, r *http.Request, v *validator.Validator, id uuid.UUID) bool {
+	pm, err := app.models.PaymentMethods.GetPaymentMethod(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("payment_method_id", "способ оплаты не найден")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	if !pm.Active || pm.ArchivedAt != nil {
+		v.AddError("payment_method_id", "способ оплаты отключен")
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	return true
+}
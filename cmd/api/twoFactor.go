@@ -0,0 +1,155 @@
+package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/totp"
+	"authCRM/internal/validator"
+	"net/http"
+	"time"
+)
+
+func (app *application) enrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	if user.TOTPEnabled {
+		app.errorResponse(w, r, http.StatusConflict, "двухфакторная аутентификация уже включена")
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.TwoFactor.SetSecret(user, secret)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(app.config.totp.issuer, user.Email, secret),
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(user.TOTPSecret != nil, "code", "сначала начните подключение двухфакторной аутентификации")
+	v.Check(!user.TOTPEnabled, "code", "двухфакторная аутентификация уже включена")
+
+	if v.Valid() {
+		counter, ok := totp.Verify(input.Code, *user.TOTPSecret, time.Now())
+		if ok {
+			ok, err = app.models.TwoFactor.UseCode(user.ID, counter)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+		v.Check(ok, "code", "неверный код")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	codes, err := app.models.TwoFactor.Enable(user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user, "recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !user.TOTPEnabled {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if app.config.totp.enforce && permissions.RequireTwoFactor() {
+		app.twoFactorRequiredResponse(w, r)
+		return
+	}
+
+	ok, err := app.checkSecondFactor(user, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !ok {
+		v := validator.New()
+		v.AddError("code", "неверный код")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.TwoFactor.Disable(user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkSecondFactor accepts either a current TOTP code that hasn't been used
+// yet or one of the user's unused recovery codes.
+func (app *application) checkSecondFactor(user *data.User, code string) (bool, error) {
+	if code == "" || user.TOTPSecret == nil {
+		return false, nil
+	}
+
+	if counter, ok := totp.Verify(code, *user.TOTPSecret, time.Now()); ok {
+		return app.models.TwoFactor.UseCode(user.ID, counter)
+	}
+
+	return app.models.TwoFactor.UseRecoveryCode(user.ID, code)
+}
@@ -0,0 +1,107 @@
+// Command lessons generates lessons from the group schedules for a date
+// range. It is safe to run repeatedly, e.g. nightly from cron:
+//
+//	lessons -from=2025-09-01 -to=2025-09-30
+package main
+
+import (
+	"authCRM/internal/data"
+	"authCRM/internal/jsonlog"
+	"authCRM/internal/validator"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+	"log"
+	"os"
+	"time"
+)
+
+func main() {
+	err := godotenv.Load(".env")
+	if err != nil {
+		log.Printf("could not get env file variable")
+	}
+
+	today := time.Now().Format(time.DateOnly)
+
+	var dsn, fromFlag, toFlag, groupFlag string
+	var days int
+
+	flag.StringVar(&dsn, "dsn", os.Getenv("DB_DSN"), "PostgreSQL DSN")
+	flag.StringVar(&fromFlag, "from", today, "First date to generate lessons for (YYYY-MM-DD)")
+	flag.StringVar(&toFlag, "to", "", "Last date to generate lessons for (YYYY-MM-DD), defaults to -days after -from")
+	flag.IntVar(&days, "days", 28, "Number of days to generate when -to is not set")
+	flag.StringVar(&groupFlag, "group", "", "Only generate lessons for this group id")
+
+	flag.Parse()
+
+	logger := jsonlog.New(os.Stdout, jsonlog.LeverInfo)
+
+	from, err := time.Parse(time.DateOnly, fromFlag)
+	if err != nil {
+		logger.PrintFatal(fmt.Errorf("invalid -from: %w", err), nil)
+	}
+
+	to := from.AddDate(0, 0, days)
+	if toFlag != "" {
+		to, err = time.Parse(time.DateOnly, toFlag)
+		if err != nil {
+			logger.PrintFatal(fmt.Errorf("invalid -to: %w", err), nil)
+		}
+	}
+
+	var groupID *uuid.UUID
+	if groupFlag != "" {
+		id, err := uuid.Parse(groupFlag)
+		if err != nil {
+			logger.PrintFatal(fmt.Errorf("invalid -group: %w", err), nil)
+		}
+		groupID = &id
+	}
+
+	v := validator.New()
+
+	if data.ValidateGenerationRange(v, from, to); !v.Valid() {
+		logger.PrintFatal(fmt.Errorf("invalid date range"), v.Errors)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	models := data.NewModels(db)
+
+	result, err := models.Schedules.Generate(from, to, groupID)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	for _, skipped := range result.Skipped {
+		logger.PrintInfo("урок пропущен: кабинет или преподаватель заняты", map[string]string{
+			"schedule_id": skipped.ScheduleID.String(),
+			"group_id":    skipped.GroupID.String(),
+			"starts_at":   skipped.StartsAt.Format(time.RFC3339),
+		})
+	}
+
+	logger.PrintInfo("уроки созданы", map[string]string{
+		"from":    from.Format(time.DateOnly),
+		"to":      to.Format(time.DateOnly),
+		"created": fmt.Sprint(result.Created),
+		"skipped": fmt.Sprint(len(result.Skipped)),
+	})
+}
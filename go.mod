@@ -3,13 +3,17 @@ module authCRM
 go 1.24.1
 
 require (
+	github.com/go-mail/mail/v2 v2.3.0
 	github.com/google/uuid v1.6.0
 	github.com/joho/godotenv v1.5.1
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/lib/pq v1.10.2
+	golang.org/x/crypto v0.41.0
+	golang.org/x/time v0.12.0
 )
 
 require (
-	golang.org/x/crypto v0.41.0 // indirect
-	golang.org/x/time v0.12.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
+	gopkg.in/mail.v2 v2.3.1 // indirect
 )
@@ -0,0 +1,217 @@
+package data
+
+import (
+	"authCRM/internal/validator"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+const apiKeyPrefix = "crm_"
+
+type APIKey struct {
+	ID        uuid.UUID   `json:"id"`
+	UserID    uuid.UUID   `json:"-"`
+	Name      string      `json:"name"`
+	Plaintext string      `json:"key,omitempty"`
+	Prefix    string      `json:"prefix"`
+	Hash      []byte      `json:"-"`
+	Scopes    Permissions `json:"scopes"`
+	Expiry    *time.Time  `json:"expiry"`
+	CreatedAt time.Time   `json:"created_at"`
+	RevokedAt *time.Time  `json:"revoked_at,omitempty"`
+}
+
+func generateAPIKey(key *APIKey) error {
+	randomBytes := make([]byte, 32)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+
+	key.Plaintext = apiKeyPrefix + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+	key.Prefix = key.Plaintext[:len(apiKeyPrefix)+8]
+	key.Hash = hashAPIKey(key.Plaintext)
+
+	return nil
+}
+
+func hashAPIKey(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+// ValidateAPIKey checks the key settings; a key can only be granted scopes
+// its owner already has.
+func ValidateAPIKey(v *validator.Validator, key *APIKey, owned Permissions) {
+	v.Check(key.Name != "", "name", "должны добавить имя!")
+	v.Check(len(key.Name) <= 200, "name", "имя не больше 200 байтов!")
+	v.Check(len(key.Scopes) > 0, "scopes", "нужен хотя бы один доступ")
+	v.Check(validator.Unique(key.Scopes), "scopes", "доступы не должны повторяться")
+
+	for _, scope := range key.Scopes {
+		v.Check(owned.Include(scope), "scopes", "нельзя выдать доступ "+scope)
+	}
+
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "срок действия должен быть в будущем")
+	}
+}
+
+func ValidateAPIKeyPlaintext(v *validator.Validator, plaintext string) {
+	v.Check(strings.HasPrefix(plaintext, apiKeyPrefix), "key", "invalid API key format")
+	v.Check(len(plaintext) == len(apiKeyPrefix)+52, "key", "invalid API key length")
+}
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+func (m APIKeyModel) Insert(key *APIKey) error {
+	err := generateAPIKey(key)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO api_keys (user_id, name, prefix, hash, scopes, expiry)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at
+`
+
+	args := []any{key.UserID, key.Name, key.Prefix, key.Hash, pq.Array([]string(key.Scopes)), key.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+func (m APIKeyModel) GetAllForUser(userID uuid.UUID) ([]*APIKey, error) {
+	query := `SELECT id, user_id, name, prefix, scopes, expiry, created_at, revoked_at
+	FROM api_keys
+	WHERE user_id = $1
+	ORDER BY created_at DESC
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+
+	for rows.Next() {
+		var key APIKey
+
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array((*[]string)(&key.Scopes)),
+			&key.Expiry,
+			&key.CreatedAt,
+			&key.RevokedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (m APIKeyModel) Revoke(id, userID uuid.UUID) error {
+	query := `UPDATE api_keys
+	SET revoked_at = NOW()
+	WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetForKey returns the active key matching the plaintext together with its
+// owner.
+func (m APIKeyModel) GetForKey(plaintext string) (*APIKey, *User, error) {
+	query := `SELECT api_keys.id, api_keys.name, api_keys.prefix, api_keys.scopes, api_keys.expiry, api_keys.created_at,
+	users.id, users.created_at, users.full_name, users.email, users.password_hash, users.activated, users.role, users.version,
+	users.totp_secret, users.totp_enabled
+	FROM api_keys
+	INNER JOIN users ON users.id = api_keys.user_id
+	WHERE api_keys.hash = $1
+	AND api_keys.revoked_at IS NULL
+	AND (api_keys.expiry IS NULL OR api_keys.expiry > NOW())
+`
+
+	var key APIKey
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hashAPIKey(plaintext)).Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array((*[]string)(&key.Scopes)),
+		&key.Expiry,
+		&key.CreatedAt,
+		&user.ID,
+		&user.CreatedAt,
+		&user.FullName,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Role,
+		&user.Version,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	key.UserID = user.ID
+
+	return &key, &user, nil
+}
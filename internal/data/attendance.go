@@ -0,0 +1,416 @@
+package data
+
+import (
+	"authCRM/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	ErrLessonCancelled   = errors.New("lesson is cancelled")
+	ErrStudentNotInGroup = errors.New("student is not enrolled in the lesson's group")
+)
+
+// StudentError ties an error to the student it happened for, so a bulk
+// request can tell the caller which mark was rejected.
+type StudentError struct {
+	StudentID uuid.UUID
+	Err       error
+}
+
+func (e *StudentError) Error() string {
+	return fmt.Sprintf("student %s: %v", e.StudentID, e.Err)
+}
+
+func (e *StudentError) Unwrap() error {
+	return e.Err
+}
+
+// Attendance is one student's mark for one lesson. Charged means a session of
+// StudentSubscriptionID was used up by this mark; Overridden means the mark
+// was accepted without a valid subscription.
+type Attendance struct {
+	ID                    uuid.UUID        `json:"id"`
+	LessonID              uuid.UUID        `json:"lesson_id"`
+	StudentID             uuid.UUID        `json:"student_id"`
+	FullName              string           `json:"full_name,omitempty"`
+	Status                AttendanceStatus `json:"status"`
+	StudentSubscriptionID *uuid.UUID       `json:"student_subscription_id"`
+	Charged               bool             `json:"charged"`
+	Overridden            bool             `json:"overridden"`
+	MarkedBy              *uuid.UUID       `json:"marked_by"`
+	MarkedAt              time.Time        `json:"marked_at"`
+}
+
+type Mark struct {
+	StudentID uuid.UUID        `json:"student_id"`
+	Status    AttendanceStatus `json:"status"`
+}
+
+func ValidateMarks(v *validator.Validator, marks []Mark) {
+	v.Check(len(marks) > 0, "marks", "должны отметить хотя бы одного студента!")
+
+	ids := make([]uuid.UUID, 0, len(marks))
+	for _, mark := range marks {
+		ids = append(ids, mark.StudentID)
+		v.Check(mark.StudentID != uuid.Nil, "marks", "должны указать студента")
+		v.Check(validator.PermittedValue(mark.Status, AttendancePresent, AttendanceLate, AttendanceExcused, AttendanceUnexcused), "marks", "неверная отметка посещения")
+	}
+
+	v.Check(validator.Unique(ids), "marks", "студент отмечен дважды")
+}
+
+type AttendanceModel struct {
+	DB *sql.DB
+}
+
+// Mark saves the marks for a lesson in one transaction. For 'количество'
+// subscriptions a chargeable mark uses up a session and a correction to a
+// non-chargeable one gives it back. Without a valid subscription a mark is
+// rejected, unless override is set.
+func (m AttendanceModel) Mark(lesson *Lesson, marks []Mark, override bool, markedBy uuid.UUID) ([]*Attendance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status LessonStatus
+
+	err = tx.QueryRowContext(ctx, `SELECT status FROM lessons WHERE id = $1 FOR UPDATE`, lesson.ID).Scan(&status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if status == LessonCancelled {
+		return nil, ErrLessonCancelled
+	}
+
+	result := []*Attendance{}
+
+	for _, mark := range marks {
+		a, err := markOne(ctx, tx, lesson, mark, override, markedBy)
+		if err != nil {
+			return nil, &StudentError{StudentID: mark.StudentID, Err: err}
+		}
+
+		result = append(result, a)
+	}
+
+	if status == LessonPlanned {
+		_, err = tx.ExecContext(ctx, `UPDATE lessons SET status = $1, version = version + 1 WHERE id = $2`, LessonConducted, lesson.ID)
+		if err != nil {
+			return nil, err
+		}
+		lesson.Status = LessonConducted
+		lesson.Version++
+	}
+
+	return result, tx.Commit()
+}
+
+func markOne(ctx context.Context, tx *sql.Tx, lesson *Lesson, mark Mark, override bool, markedBy uuid.UUID) (*Attendance, error) {
+	var enrolled bool
+
+	query := `SELECT EXISTS (
+		SELECT 1 FROM group_students
+		WHERE group_id = $1 AND student_id = $2
+		AND enrolled_at <= $3 AND (left_at IS NULL OR left_at > $3)
+	)`
+
+	err := tx.QueryRowContext(ctx, query, lesson.GroupID, mark.StudentID, lesson.Date).Scan(&enrolled)
+	if err != nil {
+		return nil, err
+	}
+
+	if !enrolled {
+		return nil, ErrStudentNotInGroup
+	}
+
+	a := &Attendance{
+		LessonID:  lesson.ID,
+		StudentID: mark.StudentID,
+		Status:    mark.Status,
+		MarkedBy:  &markedBy,
+	}
+
+	query = `SELECT student_subscription_id, charged
+	FROM attendance
+	WHERE lesson_id = $1 AND student_id = $2
+	FOR UPDATE
+`
+
+	err = tx.QueryRowContext(ctx, query, lesson.ID, mark.StudentID).Scan(&a.StudentSubscriptionID, &a.Charged)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if a.StudentSubscriptionID == nil {
+		a.Charged = false
+		a.StudentSubscriptionID, err = findValidSubscription(ctx, tx, mark.StudentID, lesson.Date)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var subType SubStatus
+
+	if a.StudentSubscriptionID != nil {
+		err = tx.QueryRowContext(ctx, `SELECT type FROM student_subscriptions WHERE id = $1 FOR UPDATE`, *a.StudentSubscriptionID).Scan(&subType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	charge := subType == Visits && mark.Status.Chargeable()
+
+	switch {
+	case a.Charged && !charge:
+		err = refundSession(ctx, tx, *a.StudentSubscriptionID)
+		if err != nil {
+			return nil, err
+		}
+		a.Charged = false
+	case !a.Charged && charge:
+		ok, err := useSession(ctx, tx, *a.StudentSubscriptionID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			// The subscription linked by an earlier mark has run out since.
+			a.StudentSubscriptionID = nil
+		}
+		a.Charged = ok
+	}
+
+	if a.StudentSubscriptionID == nil {
+		if !override {
+			return nil, ErrNoValidSubscription
+		}
+		a.Overridden = true
+	}
+
+	query = `INSERT INTO attendance (lesson_id, student_id, status, student_subscription_id, charged, overridden, marked_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (lesson_id, student_id) DO UPDATE
+	SET status = EXCLUDED.status, student_subscription_id = EXCLUDED.student_subscription_id, charged = EXCLUDED.charged,
+	overridden = EXCLUDED.overridden, marked_by = EXCLUDED.marked_by, marked_at = NOW()
+	RETURNING id, marked_at
+`
+
+	args := []any{a.LessonID, a.StudentID, a.Status, a.StudentSubscriptionID, a.Charged, a.Overridden, a.MarkedBy}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&a.ID, &a.MarkedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// findValidSubscription picks the active subscription that covers date and
+// still has sessions, the one ending soonest first. It returns nil if there
+// is none.
+func findValidSubscription(ctx context.Context, tx *sql.Tx, studentID uuid.UUID, date time.Time) (*uuid.UUID, error) {
+	query := `SELECT id FROM student_subscriptions
+	WHERE student_id = $1 AND status = $2
+	AND start_date <= $3 AND (end_date IS NULL OR end_date >= $3)
+	AND (sessions_remaining IS NULL OR sessions_remaining > 0)
+	ORDER BY end_date NULLS LAST, created_at
+	LIMIT 1
+	FOR UPDATE
+`
+
+	var id uuid.UUID
+
+	err := tx.QueryRowContext(ctx, query, studentID, StudentSubActive, date).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &id, nil
+}
+
+func useSession(ctx context.Context, tx *sql.Tx, id uuid.UUID) (bool, error) {
+	query := `UPDATE student_subscriptions
+	SET sessions_remaining = sessions_remaining - 1,
+	status = CASE WHEN sessions_remaining - 1 = 0 THEN $2 ELSE status END,
+	version = version + 1
+	WHERE id = $1 AND sessions_remaining > 0
+`
+
+	result, err := tx.ExecContext(ctx, query, id, StudentSubExhausted)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// refundSession gives a session back. An exhausted subscription becomes
+// active again unless it has run out of time in the meantime.
+func refundSession(ctx context.Context, tx *sql.Tx, id uuid.UUID) error {
+	query := `UPDATE student_subscriptions
+	SET sessions_remaining = sessions_remaining + 1,
+	status = CASE WHEN status = $2 AND (end_date IS NULL OR end_date >= CURRENT_DATE) THEN $3 ELSE status END,
+	version = version + 1
+	WHERE id = $1 AND sessions_remaining IS NOT NULL
+`
+
+	_, err := tx.ExecContext(ctx, query, id, StudentSubExhausted, StudentSubActive)
+	return err
+}
+
+func (m AttendanceModel) GetAllForLesson(lessonID uuid.UUID) ([]*Attendance, error) {
+	query := `SELECT attendance.id, attendance.lesson_id, attendance.student_id, students.full_name, attendance.status,
+	attendance.student_subscription_id, attendance.charged, attendance.overridden, attendance.marked_by, attendance.marked_at
+	FROM attendance
+	INNER JOIN students ON students.id = attendance.student_id
+	WHERE attendance.lesson_id = $1
+	ORDER BY students.full_name
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, lessonID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	marks := []*Attendance{}
+
+	for rows.Next() {
+		var a Attendance
+
+		err := rows.Scan(
+			&a.ID,
+			&a.LessonID,
+			&a.StudentID,
+			&a.FullName,
+			&a.Status,
+			&a.StudentSubscriptionID,
+			&a.Charged,
+			&a.Overridden,
+			&a.MarkedBy,
+			&a.MarkedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		marks = append(marks, &a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return marks, nil
+}
+
+// DeleteMark removes a mark made by mistake and refunds its session.
+func (m AttendanceModel) DeleteMark(lessonID, studentID uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM attendance
+	WHERE lesson_id = $1 AND student_id = $2
+	RETURNING student_subscription_id, charged
+`
+
+	var subID *uuid.UUID
+	var charged bool
+
+	err = tx.QueryRowContext(ctx, query, lessonID, studentID).Scan(&subID, &charged)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if charged && subID != nil {
+		err = refundSession(ctx, tx, *subID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// clearAttendance removes all marks of a lesson and refunds the sessions they
+// used, for a lesson that is being cancelled.
+func clearAttendance(ctx context.Context, tx *sql.Tx, lessonID uuid.UUID) error {
+	query := `DELETE FROM attendance
+	WHERE lesson_id = $1
+	RETURNING student_subscription_id, charged
+`
+
+	rows, err := tx.QueryContext(ctx, query, lessonID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	refunds := []uuid.UUID{}
+
+	for rows.Next() {
+		var subID *uuid.UUID
+		var charged bool
+
+		err := rows.Scan(&subID, &charged)
+		if err != nil {
+			return err
+		}
+
+		if charged && subID != nil {
+			refunds = append(refunds, *subID)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range refunds {
+		err = refundSession(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,16 @@
+package data
+
+type AttendanceStatus string
+
+const (
+	AttendancePresent   AttendanceStatus = "присутствовал"
+	AttendanceLate      AttendanceStatus = "опоздал"
+	AttendanceExcused   AttendanceStatus = "отсутствовал по уважительной"
+	AttendanceUnexcused AttendanceStatus = "отсутствовал без уважительной"
+)
+
+// Chargeable reports whether the mark uses up a session of a 'количество'
+// subscription. A late student still attended, so it is charged like present.
+func (s AttendanceStatus) Chargeable() bool {
+	return s == AttendancePresent || s == AttendanceLate || s == AttendanceUnexcused
+}
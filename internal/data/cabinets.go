@@ -122,12 +122,13 @@ func (c CabinetModel) DeleteCabinet(id uuid.UUID) error {
 }
 
 func (c CabinetModel) GetAllCabinets(filters Filters) ([]*Cabinet, Metadata, error) {
-	query := `SELECT COUNT(*) OVER(), id, name, address FROM cabinets`
+	query := `SELECT COUNT(*) OVER(), id, name, address FROM cabinets
+` + filters.orderBy(nil, 1, "id ASC")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := c.DB.QueryContext(ctx, query)
+	rows, err := c.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -0,0 +1,277 @@
+package data
+
+import (
+	"authCRM/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"math"
+	"time"
+)
+
+// RefundExpenseCategoryID is the expense category the migration creates for
+// refunds. Cancellations use it unless another one is given.
+var RefundExpenseCategoryID = uuid.MustParse("c3e8a1d4-5b6f-4a27-8e90-7d1c2b3a4f55")
+
+var (
+	ErrAlreadyCancelled     = errors.New("subscription is already cancelled")
+	ErrRefundMethodRequired = errors.New("a payment method is required to pay the refund")
+)
+
+// Cancellation is the settlement of a subscription cancelled before its end.
+// Used and Total are days for 'период' plans and sessions for 'количество'
+// ones; UsedValue is the part of the price they are worth. The student keeps
+// paying for UsedValue plus Fee (Charged, never more than the price) and gets
+// back whatever was paid above that.
+type Cancellation struct {
+	ID                    uuid.UUID  `json:"id"`
+	StudentSubscriptionID uuid.UUID  `json:"student_subscription_id"`
+	Date                  time.Time  `json:"date"`
+	Price                 int64      `json:"price"`
+	Used                  int        `json:"used"`
+	Total                 int        `json:"total"`
+	UsedValue             int64      `json:"used_value"`
+	Fee                   int64      `json:"fee"`
+	Charged               int64      `json:"charged"`
+	Paid                  int64      `json:"paid"`
+	Refund                int64      `json:"refund"`
+	Debt                  int64      `json:"debt"`
+	PaymentMethodID       *uuid.UUID `json:"payment_method_id"`
+	TransactionID         *uuid.UUID `json:"transaction_id"`
+	Reason                string     `json:"reason"`
+	ApprovedBy            *uuid.UUID `json:"approved_by"`
+	ApprovedAt            *time.Time `json:"approved_at"`
+}
+
+func ValidateCancellation(v *validator.Validator, c *Cancellation) {
+	v.Check(!c.Date.IsZero(), "date", "должны указать дату отмены!")
+	v.Check(c.Fee >= 0, "fee", "штраф не может быть отрицательным")
+	v.Check(len(c.Reason) <= 1000, "reason", "причина не больше 1000 байтов!")
+}
+
+// prorate works out how much of the subscription was used by c.Date.
+// Frozen days are neither used nor counted in the term.
+func (c *Cancellation) prorate(ss *StudentSubscription, frozenTotal, frozenBefore int) {
+	c.Price = int64(ss.Price)
+
+	switch ss.Type {
+	case Monthly:
+		if ss.EndDate == nil {
+			break
+		}
+
+		term := int(ss.EndDate.Sub(ss.StartDate).Hours()/24) + 1
+		elapsed := int(c.Date.Sub(ss.StartDate).Hours() / 24)
+		elapsed = max(0, min(elapsed, term))
+
+		c.Total = max(term-frozenTotal, 0)
+		c.Used = max(0, min(elapsed-frozenBefore, c.Total))
+	case Visits:
+		c.Total = int(getValue(ss.SessionsCount))
+		c.Used = c.Total - int(getValue(ss.SessionsRemaining))
+		c.Used = max(0, min(c.Used, c.Total))
+	}
+
+	if c.Total == 0 {
+		c.UsedValue = c.Price
+	} else {
+		c.UsedValue = int64(math.Round(float64(c.Price) * float64(c.Used) / float64(c.Total)))
+	}
+
+	c.Charged = min(c.UsedValue+c.Fee, c.Price)
+	c.Debt, c.Refund = settle(c.Charged, c.Paid)
+}
+
+type CancellationModel struct {
+	DB *sql.DB
+}
+
+// quote locks the subscription and fills in the settlement for c.
+func quote(ctx context.Context, tx *sql.Tx, c *Cancellation) (*StudentSubscription, error) {
+	var ss StudentSubscription
+
+	query := `SELECT ` + studentSubscriptionColumns + `
+	FROM student_subscriptions
+	WHERE id = $1
+	FOR UPDATE
+`
+
+	err := scanStudentSubscription(tx.QueryRowContext(ctx, query, c.StudentSubscriptionID), &ss)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if ss.Status == StudentSubCancelled {
+		return nil, ErrAlreadyCancelled
+	}
+
+	ss.StartDate = TruncateToDate(ss.StartDate)
+	if ss.EndDate != nil {
+		end := TruncateToDate(*ss.EndDate)
+		ss.EndDate = &end
+	}
+
+	query = `SELECT COALESCE(SUM(end_date - start_date + 1), 0),
+	COALESCE(SUM(GREATEST(LEAST(end_date, $2::date - 1) - start_date + 1, 0)), 0)
+	FROM subscription_freezes
+	WHERE student_subscription_id = $1
+`
+
+	var frozenTotal, frozenBefore int
+
+	err = tx.QueryRowContext(ctx, query, ss.ID, c.Date).Scan(&frozenTotal, &frozenBefore)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `SELECT COALESCE(SUM(amount), 0) FROM payments WHERE student_subscription_id = $1`
+
+	err = tx.QueryRowContext(ctx, query, ss.ID).Scan(&c.Paid)
+	if err != nil {
+		return nil, err
+	}
+
+	c.prorate(&ss, frozenTotal, frozenBefore)
+
+	return &ss, nil
+}
+
+// Quote calculates the refund for cancelling on c.Date without saving
+// anything.
+func (m CancellationModel) Quote(c *Cancellation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = quote(ctx, tx, c)
+
+	return err
+}
+
+// Cancel recalculates the settlement under a lock, pays the refund out as an
+// expense transaction and marks the subscription cancelled. The user who
+// approved it is recorded together with every figure of the calculation.
+func (m CancellationModel) Cancel(c *Cancellation, categoryID uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ss, err := quote(ctx, tx, c)
+	if err != nil {
+		return err
+	}
+
+	if c.Refund > 0 {
+		if c.PaymentMethodID == nil {
+			return ErrRefundMethodRequired
+		}
+
+		t := &Transaction{
+			Direction:       Expense,
+			Amount:          c.Refund,
+			CategoryID:      categoryID,
+			PaymentMethodID: *c.PaymentMethodID,
+			Date:            c.Date,
+			Comment:         fmt.Sprintf("Возврат за абонемент «%s»", ss.Name),
+			StudentID:       &ss.StudentID,
+			CreatedBy:       c.ApprovedBy,
+		}
+
+		err = insertTransaction(ctx, tx, t)
+		if err != nil {
+			return err
+		}
+
+		c.TransactionID = &t.ID
+	} else {
+		c.PaymentMethodID = nil
+	}
+
+	query := `INSERT INTO subscription_cancellations (student_subscription_id, date, price, used, total, used_value, fee,
+	charged, paid, refund, payment_method_id, transaction_id, reason, approved_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	RETURNING id, approved_at
+`
+
+	args := []any{c.StudentSubscriptionID, c.Date, c.Price, c.Used, c.Total, c.UsedValue, c.Fee,
+		c.Charged, c.Paid, c.Refund, c.PaymentMethodID, c.TransactionID, c.Reason, c.ApprovedBy}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&c.ID, &c.ApprovedAt)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE student_subscriptions
+	SET status = $1, version = version + 1
+	WHERE id = $2
+`
+
+	_, err = tx.ExecContext(ctx, query, StudentSubCancelled, ss.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m CancellationModel) GetCancellation(studentSubscriptionID uuid.UUID) (*Cancellation, error) {
+	query := `SELECT id, student_subscription_id, date, price, used, total, used_value, fee, charged, paid, refund,
+	payment_method_id, transaction_id, reason, approved_by, approved_at
+	FROM subscription_cancellations
+	WHERE student_subscription_id = $1
+`
+
+	var c Cancellation
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, studentSubscriptionID).Scan(
+		&c.ID,
+		&c.StudentSubscriptionID,
+		&c.Date,
+		&c.Price,
+		&c.Used,
+		&c.Total,
+		&c.UsedValue,
+		&c.Fee,
+		&c.Charged,
+		&c.Paid,
+		&c.Refund,
+		&c.PaymentMethodID,
+		&c.TransactionID,
+		&c.Reason,
+		&c.ApprovedBy,
+		&c.ApprovedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	c.Date = TruncateToDate(c.Date)
+	c.Debt, _ = settle(c.Charged, c.Paid)
+
+	return &c, nil
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func parseDate(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func int16Ptr(n int16) *int16 {
+	return &n
+}
+
+func TestCancellationProrate(t *testing.T) {
+	end := parseDate("2026-01-30")
+
+	monthly := &StudentSubscription{
+		Price:     3000,
+		Type:      Monthly,
+		StartDate: parseDate("2026-01-01"),
+		EndDate:   &end,
+	}
+
+	visits := func(price int32, count, remaining int16) *StudentSubscription {
+		return &StudentSubscription{
+			Price:             price,
+			Type:              Visits,
+			SessionsCount:     int16Ptr(count),
+			SessionsRemaining: int16Ptr(remaining),
+		}
+	}
+
+	tests := []struct {
+		name         string
+		ss           *StudentSubscription
+		date         string
+		fee          int64
+		paid         int64
+		frozenTotal  int
+		frozenBefore int
+		want         Cancellation
+	}{
+		{
+			name: "monthly by days",
+			ss:   monthly, date: "2026-01-11", paid: 3000,
+			want: Cancellation{Used: 10, Total: 30, UsedValue: 1000, Charged: 1000, Refund: 2000},
+		},
+		{
+			name: "monthly with fee",
+			ss:   monthly, date: "2026-01-11", fee: 200, paid: 3000,
+			want: Cancellation{Used: 10, Total: 30, UsedValue: 1000, Charged: 1200, Refund: 1800},
+		},
+		{
+			name: "frozen days are left out",
+			ss:   monthly, date: "2026-01-11", paid: 3000, frozenTotal: 5, frozenBefore: 2,
+			want: Cancellation{Used: 8, Total: 25, UsedValue: 960, Charged: 960, Refund: 2040},
+		},
+		{
+			name: "before the start",
+			ss:   monthly, date: "2025-12-20", paid: 3000,
+			want: Cancellation{Used: 0, Total: 30, UsedValue: 0, Charged: 0, Refund: 3000},
+		},
+		{
+			name: "after the end",
+			ss:   monthly, date: "2026-03-01", paid: 3000,
+			want: Cancellation{Used: 30, Total: 30, UsedValue: 3000, Charged: 3000},
+		},
+		{
+			name: "fee capped at price",
+			ss:   monthly, date: "2026-01-30", fee: 500, paid: 1000,
+			want: Cancellation{Used: 29, Total: 30, UsedValue: 2900, Charged: 3000, Debt: 2000},
+		},
+		{
+			name: "visits by sessions",
+			ss:   visits(1000, 8, 5), date: "2026-01-11", paid: 1000,
+			want: Cancellation{Used: 3, Total: 8, UsedValue: 375, Charged: 375, Refund: 625},
+		},
+		{
+			name: "rounds down",
+			ss:   visits(1000, 3, 2), date: "2026-01-11",
+			want: Cancellation{Used: 1, Total: 3, UsedValue: 333, Charged: 333, Debt: 333},
+		},
+		{
+			name: "rounds up",
+			ss:   visits(1000, 3, 1), date: "2026-01-11",
+			want: Cancellation{Used: 2, Total: 3, UsedValue: 667, Charged: 667, Debt: 667},
+		},
+		{
+			name: "nothing to prorate",
+			ss:   visits(1000, 0, 0), date: "2026-01-11", paid: 1000,
+			want: Cancellation{Used: 0, Total: 0, UsedValue: 1000, Charged: 1000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Cancellation{Date: parseDate(tt.date), Fee: tt.fee, Paid: tt.paid}
+			c.prorate(tt.ss, tt.frozenTotal, tt.frozenBefore)
+
+			got := [...]int64{int64(c.Used), int64(c.Total), c.UsedValue, c.Charged, c.Refund, c.Debt}
+			want := [...]int64{int64(tt.want.Used), int64(tt.want.Total), tt.want.UsedValue, tt.want.Charged, tt.want.Refund, tt.want.Debt}
+
+			if got != want {
+				t.Errorf("used, total, used value, charged, refund, debt = %v, want %v", got, want)
+			}
+			if c.Price != int64(tt.ss.Price) {
+				t.Errorf("price = %d, want %d", c.Price, tt.ss.Price)
+			}
+		})
+	}
+}
@@ -1 +1,276 @@
 package data
+
+import (
+	"authCRM/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	ErrStudentHasSubscriptions = errors.New("student has subscriptions")
+)
+
+// StudentSubscription is a plan sold to a student. Price and terms are copied
+// from the plan at the moment of purchase so later catalog edits don't change
+// what the student paid for.
+type StudentSubscription struct {
+	ID                uuid.UUID        `json:"id"`
+	StudentID         uuid.UUID        `json:"student_id"`
+	SubscriptionID    uuid.UUID        `json:"subscription_id"`
+	Name              string           `json:"name"`
+	Price             int32            `json:"price"`
+	Type              SubStatus        `json:"type"`
+	DurationMonths    *int16           `json:"duration_months,omitempty"`
+	SessionsCount     *int16           `json:"sessions_count,omitempty"`
+	ValidityMonths    *int16           `json:"validity_months,omitempty"`
+	MaxFreezeDays     *int16           `json:"max_freeze_days,omitempty"`
+	StartDate         time.Time        `json:"start_date"`
+	EndDate           *time.Time       `json:"end_date"`
+	SessionsRemaining *int16           `json:"sessions_remaining,omitempty"`
+	Status            StudentSubStatus `json:"status"`
+	CreatedAt         time.Time        `json:"created_at"`
+	Version           int              `json:"version"`
+}
+
+// TruncateToDate drops the time of day, keeping the calendar date in UTC.
+func TruncateToDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// NewStudentSubscription snapshots the plan and computes the last valid day
+// and the sessions balance for a purchase starting on start.
+func NewStudentSubscription(studentID uuid.UUID, plan *Subscription, start time.Time) *StudentSubscription {
+	ss := &StudentSubscription{
+		StudentID:      studentID,
+		SubscriptionID: plan.ID,
+		Name:           plan.Name,
+		Price:          plan.Price,
+		Type:           plan.Type,
+		DurationMonths: plan.DurationMonths,
+		SessionsCount:  plan.SessionsCount,
+		ValidityMonths: plan.ValidityMonths,
+		MaxFreezeDays:  plan.MaxFreezeDays,
+		StartDate:      TruncateToDate(start),
+		Status:         StudentSubActive,
+	}
+
+	var months int16
+
+	switch plan.Type {
+	case Monthly:
+		months = getValue(plan.DurationMonths)
+	case Visits:
+		months = getValue(plan.ValidityMonths)
+		if plan.SessionsCount != nil {
+			remaining := *plan.SessionsCount
+			ss.SessionsRemaining = &remaining
+		}
+	}
+
+	if months > 0 {
+		end := termEnd(ss.StartDate, int(months))
+		ss.EndDate = &end
+	}
+
+	ss.Status = ss.currentStatus(time.Now())
+
+	return ss
+}
+
+// termEnd returns the last day of a term of the given number of months that
+// starts on start: the day before the same day of the month, or the last day
+// of the target month when it is too short (Jan 31 + 1 month ends Feb 28).
+// time.AddDate would instead roll over into the next month.
+func termEnd(start time.Time, months int) time.Time {
+	first := time.Date(start.Year(), start.Month()+time.Month(months), 1, 0, 0, 0, 0, start.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+
+	if start.Day() > lastDay {
+		return first.AddDate(0, 0, lastDay-1)
+	}
+
+	return first.AddDate(0, 0, start.Day()-2)
+}
+
+// currentStatus works out whether an active subscription has run out of
+// time or sessions by now. Frozen subscriptions keep their status.
+func (ss *StudentSubscription) currentStatus(now time.Time) StudentSubStatus {
+	if ss.Status != StudentSubActive {
+		return ss.Status
+	}
+
+	if ss.EndDate != nil && ss.EndDate.Before(TruncateToDate(now)) {
+		return StudentSubExpired
+	}
+
+	if ss.SessionsRemaining != nil && *ss.SessionsRemaining <= 0 {
+		return StudentSubExhausted
+	}
+
+	return StudentSubActive
+}
+
+func ValidateStudentSubscription(v *validator.Validator, ss *StudentSubscription) {
+	v.Check(!ss.StartDate.IsZero(), "start_date", "должны указать дату начала!")
+	v.Check(ss.Type != Monthly || ss.EndDate != nil, "subscription_id", "у периодной подписки должна быть длительность")
+	v.Check(ss.Type != Visits || ss.SessionsRemaining != nil, "subscription_id", "у количественной подписки должно быть количество занятий")
+}
+
+type StudentSubscriptionModel struct {
+	DB *sql.DB
+}
+
+func (m StudentSubscriptionModel) InsertStudentSubscription(ss *StudentSubscription) error {
+	query := `INSERT INTO student_subscriptions (student_id, subscription_id, name, price, type, duration_months, sessions_count,
+	validity_months, max_freeze_days, start_date, end_date, sessions_remaining, status)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	RETURNING id, created_at, version
+`
+
+	args := []any{ss.StudentID, ss.SubscriptionID, ss.Name, ss.Price, ss.Type, ss.DurationMonths, ss.SessionsCount,
+		ss.ValidityMonths, ss.MaxFreezeDays, ss.StartDate, ss.EndDate, ss.SessionsRemaining, ss.Status}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&ss.ID, &ss.CreatedAt, &ss.Version)
+}
+
+const studentSubscriptionColumns = `id, student_id, subscription_id, name, price, type, duration_months, sessions_count,
+	validity_months, max_freeze_days, start_date, end_date, sessions_remaining, status, created_at, version`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanStudentSubscription(row rowScanner, ss *StudentSubscription) error {
+	return row.Scan(
+		&ss.ID,
+		&ss.StudentID,
+		&ss.SubscriptionID,
+		&ss.Name,
+		&ss.Price,
+		&ss.Type,
+		&ss.DurationMonths,
+		&ss.SessionsCount,
+		&ss.ValidityMonths,
+		&ss.MaxFreezeDays,
+		&ss.StartDate,
+		&ss.EndDate,
+		&ss.SessionsRemaining,
+		&ss.Status,
+		&ss.CreatedAt,
+		&ss.Version,
+	)
+}
+
+func (m StudentSubscriptionModel) GetStudentSubscription(id uuid.UUID) (*StudentSubscription, error) {
+	query := `SELECT ` + studentSubscriptionColumns + `
+	FROM student_subscriptions
+	WHERE id = $1
+`
+
+	var ss StudentSubscription
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := scanStudentSubscription(m.DB.QueryRowContext(ctx, query, id), &ss)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &ss, nil
+}
+
+func (m StudentSubscriptionModel) GetAllForStudent(studentID uuid.UUID) ([]*StudentSubscription, error) {
+	query := `SELECT ` + studentSubscriptionColumns + `
+	FROM student_subscriptions
+	WHERE student_id = $1
+	ORDER BY start_date DESC, created_at DESC
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []*StudentSubscription{}
+
+	for rows.Next() {
+		var ss StudentSubscription
+
+		err := scanStudentSubscription(rows, &ss)
+		if err != nil {
+			return nil, err
+		}
+
+		subs = append(subs, &ss)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+func (m StudentSubscriptionModel) UpdateStudentSubscription(ss *StudentSubscription) error {
+	query := `UPDATE student_subscriptions
+	SET start_date = $1, end_date = $2, sessions_remaining = $3, status = $4, version = version + 1
+	WHERE id = $5 AND version = $6
+	RETURNING version
+`
+
+	ss.Status = ss.currentStatus(time.Now())
+
+	args := []any{ss.StartDate, ss.EndDate, ss.SessionsRemaining, ss.Status, ss.ID, ss.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&ss.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpireOverdue moves active subscriptions whose end date has passed or
+// whose sessions have run out into the expired and exhausted statuses.
+func (m StudentSubscriptionModel) ExpireOverdue() (int64, error) {
+	query := `UPDATE student_subscriptions
+	SET status = CASE WHEN end_date IS NOT NULL AND end_date < CURRENT_DATE THEN 'истек'::student_sub_status
+	                  ELSE 'исчерпан'::student_sub_status END,
+	    version = version + 1
+	WHERE status = 'активный'
+	AND ((end_date IS NOT NULL AND end_date < CURRENT_DATE) OR (sessions_remaining IS NOT NULL AND sessions_remaining <= 0))
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,33 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTermEnd(t *testing.T) {
+	tests := []struct {
+		start  string
+		months int
+		want   string
+	}{
+		{"2026-01-01", 1, "2026-01-31"},
+		{"2026-01-15", 1, "2026-02-14"},
+		{"2026-01-31", 1, "2026-02-28"},
+		{"2028-01-31", 1, "2028-02-29"},
+		{"2026-01-30", 1, "2026-02-28"},
+		{"2026-03-31", 1, "2026-04-30"},
+		{"2026-04-30", 1, "2026-05-29"},
+		{"2026-02-28", 1, "2026-03-27"},
+		{"2026-11-15", 3, "2027-02-14"},
+		{"2026-08-31", 6, "2027-02-28"},
+		{"2026-01-01", 12, "2026-12-31"},
+	}
+
+	for _, tt := range tests {
+		got := termEnd(parseDate(tt.start), tt.months).Format(time.DateOnly)
+		if got != tt.want {
+			t.Errorf("termEnd(%s, %d) = %s, want %s", tt.start, tt.months, got, tt.want)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package data
 
 import (
 	"authCRM/internal/validator"
+	"fmt"
 	"math"
+	"strings"
 )
 
 type Filters struct {
@@ -44,6 +46,44 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 
 }
 
+func (f Filters) sortColumn() string {
+	for _, safeValue := range f.SortSafelist {
+		if f.Sort == safeValue {
+			return strings.TrimPrefix(f.Sort, "-")
+		}
+	}
+
+	panic("unsafe sort parameter: " + f.Sort)
+}
+
+func (f Filters) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+
+	return "ASC"
+}
+
+// sortColumns maps the sort keys a handler accepts to the SQL expressions
+// they order by. Keys without an entry are used as column names.
+type sortColumns map[string]string
+
+// orderBy builds the ORDER BY, LIMIT and OFFSET clauses of a list query. The
+// sort key comes from the safelist, so it is safe to put into the query;
+// the tiebreakers (e.g. "id ASC") keep the order of equal rows, and with it
+// the pages, stable. LIMIT and OFFSET are bound as $n and $n+1, so callers
+// append f.limit() and f.offset() to their arguments.
+func (f Filters) orderBy(columns sortColumns, n int, tiebreakers ...string) string {
+	column := f.sortColumn()
+	if expr, ok := columns[column]; ok {
+		column = expr
+	}
+
+	terms := append([]string{column + " " + f.sortDirection()}, tiebreakers...)
+
+	return fmt.Sprintf("ORDER BY %s\nLIMIT $%d OFFSET $%d", strings.Join(terms, ", "), n, n+1)
+}
+
 func (f Filters) limit() int {
 	return f.PageSize
 }
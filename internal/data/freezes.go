@@ -0,0 +1,232 @@
+package data
+
+import (
+	"authCRM/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	ErrFreezeNotAllowed    = errors.New("freezing is not allowed for this subscription")
+	ErrFreezeOverlap       = errors.New("freeze overlaps an existing one")
+	ErrFreezeLimitExceeded = errors.New("freeze days limit exceeded")
+)
+
+type Freeze struct {
+	ID                    uuid.UUID  `json:"id"`
+	StudentSubscriptionID uuid.UUID  `json:"student_subscription_id"`
+	StartDate             time.Time  `json:"start_date"`
+	EndDate               time.Time  `json:"end_date"`
+	Reason                string     `json:"reason"`
+	CreatedBy             *uuid.UUID `json:"created_by"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+// Days returns the length of the freeze, both ends included.
+func (f *Freeze) Days() int {
+	return int(f.EndDate.Sub(f.StartDate).Hours()/24) + 1
+}
+
+func ValidateFreeze(v *validator.Validator, f *Freeze, ss *StudentSubscription) {
+	v.Check(!f.StartDate.IsZero(), "start_date", "должны указать дату начала!")
+	v.Check(!f.EndDate.IsZero(), "end_date", "должны указать дату окончания!")
+	v.Check(!f.EndDate.Before(f.StartDate), "end_date", "дата окончания раньше даты начала")
+	v.Check(f.Reason != "", "reason", "должны указать причину!")
+	v.Check(len(f.Reason) <= 500, "reason", "причина не больше 500 байтов!")
+
+	v.Check(validator.PermittedValue(ss.Status, StudentSubActive, StudentSubFrozen), "status", "можно заморозить только действующую подписку")
+	v.Check(!f.StartDate.Before(ss.StartDate), "start_date", "заморозка не может начаться до начала подписки")
+	if ss.EndDate != nil {
+		v.Check(!f.StartDate.After(*ss.EndDate), "start_date", "заморозка не может начаться после окончания подписки")
+	}
+}
+
+type FreezeModel struct {
+	DB *sql.DB
+}
+
+// InsertFreeze records the freeze and pushes the subscription's end date
+// back by its length. The plan's max_freeze_days caps the total of all
+// freezes on one subscription.
+func (m FreezeModel) InsertFreeze(ss *StudentSubscription, f *Freeze) error {
+	if getValue(ss.MaxFreezeDays) <= 0 {
+		return ErrFreezeNotAllowed
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT version FROM student_subscriptions WHERE id = $1 FOR UPDATE`
+
+	var version int
+	err = tx.QueryRowContext(ctx, query, ss.ID).Scan(&version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if version != ss.Version {
+		return ErrEditConflict
+	}
+
+	query = `SELECT COALESCE(SUM(end_date - start_date + 1), 0),
+	COUNT(*) FILTER (WHERE daterange(start_date, end_date, '[]') && daterange($2, $3, '[]'))
+	FROM subscription_freezes
+	WHERE student_subscription_id = $1
+`
+
+	var usedDays, overlaps int
+	err = tx.QueryRowContext(ctx, query, ss.ID, f.StartDate, f.EndDate).Scan(&usedDays, &overlaps)
+	if err != nil {
+		return err
+	}
+
+	if overlaps > 0 {
+		return ErrFreezeOverlap
+	}
+
+	if usedDays+f.Days() > int(*ss.MaxFreezeDays) {
+		return ErrFreezeLimitExceeded
+	}
+
+	query = `INSERT INTO subscription_freezes (student_subscription_id, start_date, end_date, reason, created_by)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at
+`
+
+	err = tx.QueryRowContext(ctx, query, ss.ID, f.StartDate, f.EndDate, f.Reason, f.CreatedBy).Scan(&f.ID, &f.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if ss.EndDate != nil {
+		end := ss.EndDate.AddDate(0, 0, f.Days())
+		ss.EndDate = &end
+	}
+
+	query = `UPDATE student_subscriptions
+	SET end_date = $1, version = version + 1
+	WHERE id = $2
+	RETURNING version
+`
+
+	err = tx.QueryRowContext(ctx, query, ss.EndDate, ss.ID).Scan(&ss.Version)
+	if err != nil {
+		return err
+	}
+
+	f.StudentSubscriptionID = ss.ID
+
+	return tx.Commit()
+}
+
+func (m FreezeModel) GetAllForSubscription(studentSubscriptionID uuid.UUID) ([]*Freeze, error) {
+	query := `SELECT id, student_subscription_id, start_date, end_date, reason, created_by, created_at
+	FROM subscription_freezes
+	WHERE student_subscription_id = $1
+	ORDER BY start_date
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, studentSubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	freezes := []*Freeze{}
+
+	for rows.Next() {
+		var f Freeze
+
+		err := rows.Scan(
+			&f.ID,
+			&f.StudentSubscriptionID,
+			&f.StartDate,
+			&f.EndDate,
+			&f.Reason,
+			&f.CreatedBy,
+			&f.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		freezes = append(freezes, &f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return freezes, nil
+}
+
+// ApplyFreezes flips subscriptions and their students to 'заморожен' while a
+// freeze interval covers today, and back to 'активный' once it is over.
+// Students are only unfrozen on the day after a freeze on one of their
+// subscriptions ended, so a student frozen by hand later on stays frozen. The
+// status refresh runs hourly, so that day isn't missed.
+func (m FreezeModel) ApplyFreezes() error {
+	queries := []string{
+		`UPDATE student_subscriptions ss
+		SET status = 'заморожен', version = version + 1
+		WHERE ss.status = 'активный'
+		AND EXISTS (SELECT 1 FROM subscription_freezes f
+		            WHERE f.student_subscription_id = ss.id AND CURRENT_DATE BETWEEN f.start_date AND f.end_date)`,
+
+		`UPDATE student_subscriptions ss
+		SET status = 'активный', version = version + 1
+		WHERE ss.status = 'заморожен'
+		AND NOT EXISTS (SELECT 1 FROM subscription_freezes f
+		                WHERE f.student_subscription_id = ss.id AND CURRENT_DATE BETWEEN f.start_date AND f.end_date)`,
+
+		`UPDATE students s
+		SET status = 'заморожен', version = version + 1
+		WHERE s.status = 'активный'
+		AND EXISTS (SELECT 1 FROM student_subscriptions ss
+		            WHERE ss.student_id = s.id AND ss.status = 'заморожен')`,
+
+		`UPDATE students s
+		SET status = 'активный', version = version + 1
+		WHERE s.status = 'заморожен'
+		AND NOT EXISTS (SELECT 1 FROM student_subscriptions ss
+		                WHERE ss.student_id = s.id AND ss.status = 'заморожен')
+		AND EXISTS (SELECT 1 FROM subscription_freezes f
+		            INNER JOIN student_subscriptions ss ON ss.id = f.student_subscription_id
+		            WHERE ss.student_id = s.id AND f.end_date = CURRENT_DATE - 1)`,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range queries {
+		_, err = tx.ExecContext(ctx, query)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,422 @@
+package data
+
+import (
+	"authCRM/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	ErrGroupFull           = errors.New("group is full")
+	ErrAlreadyEnrolled     = errors.New("student is already enrolled")
+	ErrNotEnrolled         = errors.New("student is not enrolled")
+	ErrLeftBeforeEnrolled  = errors.New("leave date is before the enrollment date")
+	ErrNoValidSubscription = errors.New("student has no valid subscription")
+)
+
+type Group struct {
+	ID        uuid.UUID  `json:"id"`
+	Name      string     `json:"name"`
+	Course    string     `json:"course"`
+	TeacherID *uuid.UUID `json:"teacher_id"`
+	CabinetID *uuid.UUID `json:"cabinet_id"`
+	Capacity  int        `json:"capacity"`
+	Level     string     `json:"level"`
+	StartDate time.Time  `json:"start_date"`
+	EndDate   *time.Time `json:"end_date"`
+	Enrolled  int        `json:"enrolled"`
+	CreatedAt time.Time  `json:"created_at"`
+	Version   int        `json:"version"`
+}
+
+type Enrollment struct {
+	ID         uuid.UUID  `json:"id"`
+	GroupID    uuid.UUID  `json:"group_id"`
+	StudentID  uuid.UUID  `json:"student_id"`
+	FullName   string     `json:"full_name,omitempty"`
+	EnrolledAt time.Time  `json:"enrolled_at"`
+	LeftAt     *time.Time `json:"left_at,omitempty"`
+}
+
+func ValidateGroup(v *validator.Validator, group *Group) {
+	v.Check(group.Name != "", "name", "должны добавить имя!")
+	v.Check(len(group.Name) <= 200, "name", "имя не больше 200 байтов!")
+	v.Check(group.Course != "", "course", "должны указать курс!")
+	v.Check(group.Capacity > 0, "capacity", "вместимость должна быть больше нуля!")
+	v.Check(!group.StartDate.IsZero(), "start_date", "должны указать дату начала!")
+	if group.EndDate != nil {
+		v.Check(!group.EndDate.Before(group.StartDate), "end_date", "дата окончания раньше даты начала")
+	}
+}
+
+type GroupModel struct {
+	DB *sql.DB
+}
+
+func (g GroupModel) InsertGroup(group *Group) error {
+	query := `INSERT INTO groups (name, course, teacher_id, cabinet_id, capacity, level, start_date, end_date)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id, created_at, version
+`
+
+	args := []any{group.Name, group.Course, group.TeacherID, group.CabinetID, group.Capacity, group.Level, group.StartDate, group.EndDate}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return g.DB.QueryRowContext(ctx, query, args...).Scan(&group.ID, &group.CreatedAt, &group.Version)
+}
+
+func (g GroupModel) GetGroup(id uuid.UUID) (*Group, error) {
+	query := `SELECT id, name, course, teacher_id, cabinet_id, capacity, COALESCE(level, ''), start_date, end_date,
+	(SELECT COUNT(*) FROM group_students WHERE group_id = groups.id AND left_at IS NULL),
+	created_at, version
+	FROM groups
+	WHERE id = $1
+`
+
+	var group Group
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := g.DB.QueryRowContext(ctx, query, id).Scan(
+		&group.ID,
+		&group.Name,
+		&group.Course,
+		&group.TeacherID,
+		&group.CabinetID,
+		&group.Capacity,
+		&group.Level,
+		&group.StartDate,
+		&group.EndDate,
+		&group.Enrolled,
+		&group.CreatedAt,
+		&group.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &group, nil
+}
+
+func (g GroupModel) UpdateGroup(group *Group) error {
+	query := `UPDATE groups
+	SET name = $1, course = $2, teacher_id = $3, cabinet_id = $4, capacity = $5, level = $6, start_date = $7, end_date = $8, version = version + 1
+	WHERE id = $9 AND version = $10
+	RETURNING version
+`
+
+	args := []any{group.Name, group.Course, group.TeacherID, group.CabinetID, group.Capacity, group.Level, group.StartDate, group.EndDate, group.ID, group.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := g.DB.QueryRowContext(ctx, query, args...).Scan(&group.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (g GroupModel) DeleteGroup(id uuid.UUID) error {
+	query := `DELETE FROM groups
+	WHERE id = $1
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := g.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (g GroupModel) GetAllGroups(search string, teacherID *uuid.UUID, filters Filters) ([]*Group, Metadata, error) {
+	query := fmt.Sprintf(`SELECT COUNT(*) OVER(), id, name, course, teacher_id, cabinet_id, capacity, COALESCE(level, ''), start_date, end_date,
+	(SELECT COUNT(*) FROM group_students WHERE group_id = groups.id AND left_at IS NULL),
+	created_at, version
+FROM groups
+WHERE (name ILIKE '%%' || $1 || '%%' OR course ILIKE '%%' || $1 || '%%' OR $1 = '')
+  AND ($2::uuid IS NULL OR teacher_id = $2)
+%s`, filters.orderBy(nil, 3, "id ASC"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := g.DB.QueryContext(ctx, query, search, teacherID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	groups := []*Group{}
+
+	for rows.Next() {
+		var group Group
+
+		err := rows.Scan(
+			&totalRecords,
+			&group.ID,
+			&group.Name,
+			&group.Course,
+			&group.TeacherID,
+			&group.CabinetID,
+			&group.Capacity,
+			&group.Level,
+			&group.StartDate,
+			&group.EndDate,
+			&group.Enrolled,
+			&group.CreatedAt,
+			&group.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		groups = append(groups, &group)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return groups, metadata, nil
+}
+
+func (g GroupModel) GetEnrollments(groupID uuid.UUID) ([]*Enrollment, error) {
+	query := `SELECT group_students.id, group_students.group_id, group_students.student_id, students.full_name,
+	group_students.enrolled_at, group_students.left_at
+	FROM group_students
+	INNER JOIN students ON students.id = group_students.student_id
+	WHERE group_students.group_id = $1 AND group_students.left_at IS NULL
+	ORDER BY students.full_name
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := g.DB.QueryContext(ctx, query, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	enrollments := []*Enrollment{}
+
+	for rows.Next() {
+		var e Enrollment
+
+		err := rows.Scan(&e.ID, &e.GroupID, &e.StudentID, &e.FullName, &e.EnrolledAt, &e.LeftAt)
+		if err != nil {
+			return nil, err
+		}
+
+		enrollments = append(enrollments, &e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return enrollments, nil
+}
+
+// Enroll adds the student to the group on the given date. The group row is
+// locked so two concurrent enrollments can't both take the last seat.
+func (g GroupModel) Enroll(groupID, studentID uuid.UUID, date time.Time) (*Enrollment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := g.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	enrollment, err := enroll(ctx, tx, groupID, studentID, date)
+	if err != nil {
+		return nil, err
+	}
+
+	return enrollment, tx.Commit()
+}
+
+func (g GroupModel) Unenroll(groupID, studentID uuid.UUID, date time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := g.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = unenroll(ctx, tx, groupID, studentID, date)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Transfer moves the student from one group to another in one transaction:
+// they leave the old group and join the new one on the same date.
+func (g GroupModel) Transfer(fromGroupID, toGroupID, studentID uuid.UUID, date time.Time) (*Enrollment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := g.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = unenroll(ctx, tx, fromGroupID, studentID, date)
+	if err != nil {
+		return nil, err
+	}
+
+	enrollment, err := enroll(ctx, tx, toGroupID, studentID, date)
+	if err != nil {
+		return nil, err
+	}
+
+	return enrollment, tx.Commit()
+}
+
+// unenroll closes the student's current enrollment in the group on date,
+// which can't be before the day they joined.
+func unenroll(ctx context.Context, tx *sql.Tx, groupID, studentID uuid.UUID, date time.Time) error {
+	query := `SELECT enrolled_at FROM group_students
+	WHERE group_id = $1 AND student_id = $2 AND left_at IS NULL
+	FOR UPDATE
+`
+
+	var enrolledAt time.Time
+
+	err := tx.QueryRowContext(ctx, query, groupID, studentID).Scan(&enrolledAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotEnrolled
+		default:
+			return err
+		}
+	}
+
+	if date.Before(TruncateToDate(enrolledAt)) {
+		return ErrLeftBeforeEnrolled
+	}
+
+	query = `UPDATE group_students
+	SET left_at = $3
+	WHERE group_id = $1 AND student_id = $2 AND left_at IS NULL
+`
+
+	_, err = tx.ExecContext(ctx, query, groupID, studentID, date)
+	return err
+}
+
+func enroll(ctx context.Context, tx *sql.Tx, groupID, studentID uuid.UUID, date time.Time) (*Enrollment, error) {
+	var capacity, enrolled int
+	var already bool
+
+	query := `SELECT capacity FROM groups WHERE id = $1 FOR UPDATE`
+
+	err := tx.QueryRowContext(ctx, query, groupID).Scan(&capacity)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `SELECT COUNT(*), COALESCE(BOOL_OR(student_id = $2), false)
+	FROM group_students
+	WHERE group_id = $1 AND left_at IS NULL
+`
+
+	err = tx.QueryRowContext(ctx, query, groupID, studentID).Scan(&enrolled, &already)
+	if err != nil {
+		return nil, err
+	}
+
+	if already {
+		return nil, ErrAlreadyEnrolled
+	}
+
+	if enrolled >= capacity {
+		return nil, ErrGroupFull
+	}
+
+	var valid bool
+
+	query = `SELECT EXISTS (
+		SELECT 1 FROM student_subscriptions
+		WHERE student_id = $1
+		AND status IN ('активный', 'заморожен')
+		AND start_date <= $2
+		AND (end_date IS NULL OR end_date >= $2)
+	)`
+
+	err = tx.QueryRowContext(ctx, query, studentID, date).Scan(&valid)
+	if err != nil {
+		return nil, err
+	}
+
+	if !valid {
+		return nil, ErrNoValidSubscription
+	}
+
+	enrollment := &Enrollment{
+		GroupID:    groupID,
+		StudentID:  studentID,
+		EnrolledAt: date,
+	}
+
+	query = `INSERT INTO group_students (group_id, student_id, enrolled_at)
+	VALUES ($1, $2, $3)
+	RETURNING id
+`
+
+	err = tx.QueryRowContext(ctx, query, groupID, studentID, date).Scan(&enrollment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return enrollment, nil
+}
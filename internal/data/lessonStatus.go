@@ -0,0 +1,9 @@
+package data
+
+type LessonStatus string
+
+const (
+	LessonPlanned   LessonStatus = "запланирован"
+	LessonConducted LessonStatus = "проведен"
+	LessonCancelled LessonStatus = "отменен"
+)
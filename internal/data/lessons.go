@@ -0,0 +1,352 @@
+package data
+
+import (
+	"authCRM/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"time"
+)
+
+var (
+	ErrLessonConflict  = errors.New("lesson overlaps another lesson in the same cabinet or with the same teacher")
+	ErrLessonConducted = errors.New("conducted lesson can't be planned again")
+)
+
+type Lesson struct {
+	ID         uuid.UUID    `json:"id"`
+	GroupID    uuid.UUID    `json:"group_id"`
+	ScheduleID *uuid.UUID   `json:"schedule_id"`
+	TeacherID  *uuid.UUID   `json:"teacher_id"`
+	CabinetID  *uuid.UUID   `json:"cabinet_id"`
+	Date       time.Time    `json:"date"`
+	StartsAt   time.Time    `json:"starts_at"`
+	EndsAt     time.Time    `json:"ends_at"`
+	Status     LessonStatus `json:"status"`
+	CreatedAt  time.Time    `json:"created_at"`
+	Version    int          `json:"version"`
+}
+
+// Slot is a free stretch of time, as returned by the availability endpoint.
+type Slot struct {
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+func ValidateLesson(v *validator.Validator, l *Lesson) {
+	v.Check(l.GroupID != uuid.Nil, "group_id", "должны указать группу!")
+	v.Check(!l.StartsAt.IsZero(), "starts_at", "должны указать время начала!")
+	v.Check(!l.EndsAt.IsZero(), "ends_at", "должны указать время окончания!")
+	v.Check(l.EndsAt.After(l.StartsAt), "ends_at", "время окончания раньше времени начала")
+	v.Check(l.EndsAt.Sub(l.StartsAt) <= 12*time.Hour, "ends_at", "урок не может длиться больше 12 часов")
+	v.Check(validator.PermittedValue(l.Status, LessonPlanned, LessonConducted, LessonCancelled), "status", "неверный статус урока")
+}
+
+// isExclusionViolation reports whether err comes from one of the lessons
+// exclusion constraints, i.e. the cabinet or the teacher is already busy.
+func isExclusionViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23P01"
+}
+
+type LessonFilter struct {
+	From      *time.Time
+	To        *time.Time
+	GroupID   *uuid.UUID
+	TeacherID *uuid.UUID
+	CabinetID *uuid.UUID
+}
+
+type LessonModel struct {
+	DB *sql.DB
+}
+
+const lessonColumns = `id, group_id, schedule_id, teacher_id, cabinet_id, date, starts_at, ends_at, status, created_at, version`
+
+func scanLesson(row rowScanner, l *Lesson) error {
+	err := row.Scan(
+		&l.ID,
+		&l.GroupID,
+		&l.ScheduleID,
+		&l.TeacherID,
+		&l.CabinetID,
+		&l.Date,
+		&l.StartsAt,
+		&l.EndsAt,
+		&l.Status,
+		&l.CreatedAt,
+		&l.Version,
+	)
+	if err != nil {
+		return err
+	}
+
+	l.Date = TruncateToDate(l.Date)
+
+	return nil
+}
+
+func (m LessonModel) InsertLesson(l *Lesson) error {
+	query := `INSERT INTO lessons (group_id, schedule_id, teacher_id, cabinet_id, date, starts_at, ends_at, status)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id, created_at, version
+`
+
+	args := []any{l.GroupID, l.ScheduleID, l.TeacherID, l.CabinetID, l.Date, l.StartsAt, l.EndsAt, l.Status}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&l.ID, &l.CreatedAt, &l.Version)
+	if err != nil {
+		switch {
+		case isExclusionViolation(err):
+			return ErrLessonConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateLesson saves a moved or re-assigned lesson. The date stays the one the
+// schedule generated it for, so the generator won't create it a second time.
+// Cancelling a lesson removes its marks and gives the charged sessions back;
+// a conducted lesson can't be made planned again.
+func (m LessonModel) UpdateLesson(l *Lesson) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status LessonStatus
+
+	err = tx.QueryRowContext(ctx, `SELECT status FROM lessons WHERE id = $1 FOR UPDATE`, l.ID).Scan(&status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if status == LessonConducted && l.Status == LessonPlanned {
+		return ErrLessonConducted
+	}
+
+	if status != LessonCancelled && l.Status == LessonCancelled {
+		err = clearAttendance(ctx, tx, l.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `UPDATE lessons
+	SET teacher_id = $1, cabinet_id = $2, starts_at = $3, ends_at = $4, status = $5, version = version + 1
+	WHERE id = $6 AND version = $7
+	RETURNING version
+`
+
+	args := []any{l.TeacherID, l.CabinetID, l.StartsAt, l.EndsAt, l.Status, l.ID, l.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&l.Version)
+	if err != nil {
+		switch {
+		case isExclusionViolation(err):
+			return ErrLessonConflict
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetConflicts returns the lessons that overlap l in the same cabinet or with
+// the same teacher. Cancelled lessons don't occupy anything.
+func (m LessonModel) GetConflicts(l *Lesson) ([]*Lesson, error) {
+	query := `SELECT ` + lessonColumns + `
+	FROM lessons
+	WHERE status <> $1
+	AND id <> $2
+	AND tstzrange(starts_at, ends_at) && tstzrange($3, $4)
+	AND (cabinet_id = $5 OR teacher_id = $6)
+	ORDER BY starts_at, id
+`
+
+	args := []any{LessonCancelled, l.ID, l.StartsAt, l.EndsAt, l.CabinetID, l.TeacherID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.queryLessons(ctx, query, args...)
+}
+
+// GetBusy returns the cabinet's lessons that overlap [from, to).
+func (m LessonModel) GetBusy(cabinetID uuid.UUID, from, to time.Time) ([]*Lesson, error) {
+	query := `SELECT ` + lessonColumns + `
+	FROM lessons
+	WHERE status <> $1
+	AND cabinet_id = $2
+	AND tstzrange(starts_at, ends_at) && tstzrange($3, $4)
+	ORDER BY starts_at, id
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.queryLessons(ctx, query, LessonCancelled, cabinetID, from, to)
+}
+
+func (m LessonModel) queryLessons(ctx context.Context, query string, args ...any) ([]*Lesson, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lessons := []*Lesson{}
+
+	for rows.Next() {
+		var lesson Lesson
+
+		err := scanLesson(rows, &lesson)
+		if err != nil {
+			return nil, err
+		}
+
+		lessons = append(lessons, &lesson)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lessons, nil
+}
+
+// FreeSlots subtracts the busy lessons (sorted by start) from the working
+// hours of every day between from and to, both dates included. dayStart and
+// dayEnd are "HH:MM" in loc.
+func FreeSlots(busy []*Lesson, from, to time.Time, dayStart, dayEnd string, loc *time.Location) []Slot {
+	open, _ := time.Parse("15:04", dayStart)
+	closed, _ := time.Parse("15:04", dayEnd)
+
+	slots := []Slot{}
+
+	for d := TruncateToDate(from); !d.After(TruncateToDate(to)); d = d.AddDate(0, 0, 1) {
+		cursor := time.Date(d.Year(), d.Month(), d.Day(), open.Hour(), open.Minute(), 0, 0, loc)
+		end := time.Date(d.Year(), d.Month(), d.Day(), closed.Hour(), closed.Minute(), 0, 0, loc)
+
+		for _, l := range busy {
+			if !l.EndsAt.After(cursor) || !l.StartsAt.Before(end) {
+				continue
+			}
+
+			if l.StartsAt.After(cursor) {
+				slots = append(slots, Slot{StartsAt: cursor, EndsAt: l.StartsAt.In(loc)})
+			}
+
+			cursor = l.EndsAt.In(loc)
+		}
+
+		if cursor.Before(end) {
+			slots = append(slots, Slot{StartsAt: cursor, EndsAt: end})
+		}
+	}
+
+	return slots
+}
+
+func (m LessonModel) GetLesson(id uuid.UUID) (*Lesson, error) {
+	query := `SELECT ` + lessonColumns + `
+	FROM lessons
+	WHERE id = $1
+`
+
+	var lesson Lesson
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := scanLesson(m.DB.QueryRowContext(ctx, query, id), &lesson)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &lesson, nil
+}
+
+func (m LessonModel) GetAllLessons(lf LessonFilter, filters Filters) ([]*Lesson, Metadata, error) {
+	query := fmt.Sprintf(`SELECT COUNT(*) OVER(), %s
+	FROM lessons
+	WHERE ($1::timestamptz IS NULL OR ends_at > $1)
+	AND ($2::timestamptz IS NULL OR starts_at < $2)
+	AND ($3::uuid IS NULL OR group_id = $3)
+	AND ($4::uuid IS NULL OR teacher_id = $4)
+	AND ($5::uuid IS NULL OR cabinet_id = $5)
+	%s`, lessonColumns, filters.orderBy(nil, 6, "id ASC"))
+
+	args := []any{lf.From, lf.To, lf.GroupID, lf.TeacherID, lf.CabinetID, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	lessons := []*Lesson{}
+
+	for rows.Next() {
+		var lesson Lesson
+
+		err := rows.Scan(
+			&totalRecords,
+			&lesson.ID,
+			&lesson.GroupID,
+			&lesson.ScheduleID,
+			&lesson.TeacherID,
+			&lesson.CabinetID,
+			&lesson.Date,
+			&lesson.StartsAt,
+			&lesson.EndsAt,
+			&lesson.Status,
+			&lesson.CreatedAt,
+			&lesson.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		lesson.Date = TruncateToDate(lesson.Date)
+		lessons = append(lessons, &lesson)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return lessons, metadata, nil
+}
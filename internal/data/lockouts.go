@@ -0,0 +1,181 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"time"
+)
+
+type Lockout struct {
+	ID             int64     `json:"id"`
+	UserID         uuid.UUID `json:"user_id"`
+	FailedAttempts int       `json:"failed_attempts"`
+	LockedAt       time.Time `json:"locked_at"`
+	LockedUntil    time.Time `json:"locked_until"`
+}
+
+// LockoutPolicy describes how failed logins are throttled: every failure
+// doubles the delay before the next attempt, up to LockoutDuration, and after
+// MaxAttempts failures the account is locked for LockoutDuration.
+type LockoutPolicy struct {
+	MaxAttempts     int
+	BaseDelay       time.Duration
+	LockoutDuration time.Duration
+}
+
+// RetryAfter returns how long the user must wait before the next login
+// attempt is accepted, or zero if they may try right away.
+func (p LockoutPolicy) RetryAfter(user *User, now time.Time) time.Duration {
+	if user.LockedUntil != nil && user.LockedUntil.After(now) {
+		return user.LockedUntil.Sub(now)
+	}
+
+	if user.FailedLoginAttempts == 0 || user.FailedLoginAttempts >= p.MaxAttempts || user.LastFailedLoginAt == nil {
+		return 0
+	}
+
+	delay := p.backoff(user.FailedLoginAttempts)
+	next := user.LastFailedLoginAt.Add(delay)
+
+	if next.After(now) {
+		return next.Sub(now)
+	}
+
+	return 0
+}
+
+// backoff doubles BaseDelay for every failure after the first. It stops at
+// LockoutDuration before the doubling can overflow, so a large MaxAttempts
+// can't turn the delay negative.
+func (p LockoutPolicy) backoff(failures int) time.Duration {
+	delay := p.BaseDelay
+
+	for i := 1; i < failures; i++ {
+		if delay > p.LockoutDuration/2 {
+			return p.LockoutDuration
+		}
+		delay *= 2
+	}
+
+	return min(delay, p.LockoutDuration)
+}
+
+type LockoutModel struct {
+	DB *sql.DB
+}
+
+// RecordFailure counts a failed login against the user. Once the policy's
+// limit is reached the account is locked, the lockout is stored and returned.
+func (m LockoutModel) RecordFailure(user *User, policy LockoutPolicy) (*Lockout, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users
+	SET failed_login_attempts = CASE WHEN locked_until IS NOT NULL AND locked_until <= NOW() THEN 1 ELSE failed_login_attempts + 1 END,
+	    last_failed_login_at = NOW(),
+	    locked_until = CASE WHEN locked_until IS NOT NULL AND locked_until <= NOW() THEN NULL ELSE locked_until END
+	WHERE id = $1
+	RETURNING failed_login_attempts, last_failed_login_at
+`
+
+	err = tx.QueryRowContext(ctx, query, user.ID).Scan(&user.FailedLoginAttempts, &user.LastFailedLoginAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.FailedLoginAttempts < policy.MaxAttempts {
+		return nil, tx.Commit()
+	}
+
+	lockout := &Lockout{
+		UserID:         user.ID,
+		FailedAttempts: user.FailedLoginAttempts,
+		LockedUntil:    time.Now().Add(policy.LockoutDuration),
+	}
+
+	query = `UPDATE users
+	SET locked_until = $1
+	WHERE id = $2
+`
+
+	_, err = tx.ExecContext(ctx, query, lockout.LockedUntil, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `INSERT INTO user_lockouts (user_id, failed_attempts, locked_until)
+	VALUES ($1, $2, $3)
+	RETURNING id, locked_at
+`
+
+	err = tx.QueryRowContext(ctx, query, lockout.UserID, lockout.FailedAttempts, lockout.LockedUntil).Scan(&lockout.ID, &lockout.LockedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	user.LockedUntil = &lockout.LockedUntil
+
+	return lockout, tx.Commit()
+}
+
+func (m LockoutModel) Reset(userID uuid.UUID) error {
+	query := `UPDATE users
+	SET failed_login_attempts = 0, last_failed_login_at = NULL, locked_until = NULL
+	WHERE id = $1
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+func (m LockoutModel) GetAllForUser(userID uuid.UUID) ([]*Lockout, error) {
+	query := `SELECT id, user_id, failed_attempts, locked_at, locked_until
+	FROM user_lockouts
+	WHERE user_id = $1
+	ORDER BY locked_at DESC
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lockouts := []*Lockout{}
+
+	for rows.Next() {
+		var lockout Lockout
+
+		err := rows.Scan(
+			&lockout.ID,
+			&lockout.UserID,
+			&lockout.FailedAttempts,
+			&lockout.LockedAt,
+			&lockout.LockedUntil,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		lockouts = append(lockouts, &lockout)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lockouts, nil
+}
@@ -0,0 +1,49 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutBackoff(t *testing.T) {
+	p := LockoutPolicy{
+		MaxAttempts:     1000,
+		BaseDelay:       time.Second,
+		LockoutDuration: 15 * time.Minute,
+	}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{10, 512 * time.Second},
+		{11, 15 * time.Minute},
+		{64, 15 * time.Minute},
+		{999, 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := p.backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestRetryAfterLargeAttemptCount(t *testing.T) {
+	p := LockoutPolicy{
+		MaxAttempts:     1000,
+		BaseDelay:       time.Second,
+		LockoutDuration: 15 * time.Minute,
+	}
+
+	now := time.Now()
+	last := now.Add(-time.Minute)
+	user := &User{FailedLoginAttempts: 100, LastFailedLoginAt: &last}
+
+	if got, want := p.RetryAfter(user, now), 14*time.Minute; got != want {
+		t.Errorf("RetryAfter = %v, want %v", got, want)
+	}
+}
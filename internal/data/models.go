@@ -11,17 +11,55 @@ var (
 )
 
 type Models struct {
-	Teachers      TeacherModel
-	Users         UserModel
-	Cabinets      CabinetModel
-	Subscriptions SubModel
+	Teachers             TeacherModel
+	Users                UserModel
+	Cabinets             CabinetModel
+	Subscriptions        SubModel
+	Tokens               TokenModel
+	Permissions          PermissionModel
+	Lockouts             LockoutModel
+	TwoFactor            TwoFactorModel
+	APIKeys              APIKeyModel
+	Students             StudentModel
+	StudentSubscriptions StudentSubscriptionModel
+	Freezes              FreezeModel
+	Groups               GroupModel
+	Schedules            ScheduleModel
+	Lessons              LessonModel
+	Attendance           AttendanceModel
+	PaymentMethods       PaymentMethodModel
+	Categories           CategoryModel
+	Transactions         TransactionModel
+	Payments             PaymentModel
+	SalaryRates          SalaryRateModel
+	Payrolls             PayrollModel
+	Cancellations        CancellationModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Teachers:      TeacherModel{DB: db},
-		Users:         UserModel{DB: db},
-		Cabinets:      CabinetModel{DB: db},
-		Subscriptions: SubModel{DB: db},
+		Teachers:             TeacherModel{DB: db},
+		Users:                UserModel{DB: db},
+		Cabinets:             CabinetModel{DB: db},
+		Subscriptions:        SubModel{DB: db},
+		Tokens:               TokenModel{DB: db},
+		Permissions:          PermissionModel{DB: db},
+		Lockouts:             LockoutModel{DB: db},
+		TwoFactor:            TwoFactorModel{DB: db},
+		APIKeys:              APIKeyModel{DB: db},
+		Students:             StudentModel{DB: db},
+		StudentSubscriptions: StudentSubscriptionModel{DB: db},
+		Freezes:              FreezeModel{DB: db},
+		Groups:               GroupModel{DB: db},
+		Schedules:            ScheduleModel{DB: db},
+		Lessons:              LessonModel{DB: db},
+		Attendance:           AttendanceModel{DB: db},
+		PaymentMethods:       PaymentMethodModel{DB: db},
+		Categories:           CategoryModel{DB: db},
+		Transactions:         TransactionModel{DB: db},
+		Payments:             PaymentModel{DB: db},
+		SalaryRates:          SalaryRateModel{DB: db},
+		Payrolls:             PayrollModel{DB: db},
+		Cancellations:        CancellationModel{DB: db},
 	}
 }
@@ -0,0 +1,130 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+var ErrInvalidHash = errors.New("invalid password hash format")
+
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// PasswordParams are used for every newly hashed password. main overrides
+// them from the command line so the cost can be tuned per deployment.
+var PasswordParams = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Validate checks the limits argon2.IDKey relies on; it panics on zero
+// iterations or parallelism.
+func (p Argon2Params) Validate() error {
+	switch {
+	case p.Iterations < 1:
+		return errors.New("argon2 iterations must be at least 1")
+	case p.Parallelism < 1:
+		return errors.New("argon2 parallelism must be at least 1")
+	case p.Memory < 8*uint32(p.Parallelism):
+		return errors.New("argon2 memory must be at least 8 KiB per degree of parallelism")
+	case p.SaltLength < 8:
+		return errors.New("argon2 salt must be at least 8 bytes")
+	case p.KeyLength < 4:
+		return errors.New("argon2 key must be at least 4 bytes")
+	}
+
+	return nil
+}
+
+// hashArgon2id returns the hash in the PHC string format, e.g.
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>, so the parameters travel
+// with the hash and older hashes keep verifying after the cost is changed.
+func hashArgon2id(plaintext string, p Argon2Params) ([]byte, error) {
+	salt := make([]byte, p.SaltLength)
+
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(plaintext), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		p.Memory,
+		p.Iterations,
+		p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return []byte(encoded), nil
+}
+
+func isArgon2id(hash []byte) bool {
+	return strings.HasPrefix(string(hash), "$argon2id$")
+}
+
+func decodeArgon2id(hash []byte) (Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return Argon2Params{}, nil, nil, err
+	}
+	if version != argon2.Version {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var p Argon2Params
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism)
+	if err != nil {
+		return Argon2Params{}, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.Strict().DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, err
+	}
+	p.SaltLength = uint32(len(salt))
+
+	key, err := base64.RawStdEncoding.Strict().DecodeString(parts[5])
+	if err != nil {
+		return Argon2Params{}, nil, nil, err
+	}
+	p.KeyLength = uint32(len(key))
+
+	if p.Validate() != nil {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	return p, salt, key, nil
+}
+
+func matchArgon2id(plaintext string, hash []byte) (bool, error) {
+	p, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+
+	otherKey := argon2.IDKey([]byte(plaintext), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
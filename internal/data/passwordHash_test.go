@@ -0,0 +1,196 @@
+package data
+
+import (
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+// testParams keep the tests fast; only the structure of the hash matters.
+var testParams = Argon2Params{
+	Memory:      64,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func withPasswordParams(t *testing.T, p Argon2Params) {
+	t.Helper()
+
+	saved := PasswordParams
+	PasswordParams = p
+	t.Cleanup(func() { PasswordParams = saved })
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	withPasswordParams(t, testParams)
+
+	var p password
+	if err := p.Set("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(p.hash), "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("unexpected PHC string %q", p.hash)
+	}
+
+	params, salt, key, err := decodeArgon2id(p.hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params != testParams {
+		t.Errorf("decoded params = %+v, want %+v", params, testParams)
+	}
+	if len(salt) != int(testParams.SaltLength) || len(key) != int(testParams.KeyLength) {
+		t.Errorf("salt/key length = %d/%d", len(salt), len(key))
+	}
+
+	match, err := p.Matches("correct horse")
+	if err != nil || !match {
+		t.Errorf("Matches(correct) = %v, %v; want true", match, err)
+	}
+
+	match, err = p.Matches("wrong horse")
+	if err != nil || match {
+		t.Errorf("Matches(wrong) = %v, %v; want false", match, err)
+	}
+
+	if p.NeedsRehash() {
+		t.Error("NeedsRehash = true for a hash made with the current params")
+	}
+}
+
+func TestArgon2idSaltIsRandom(t *testing.T) {
+	withPasswordParams(t, testParams)
+
+	var a, b password
+	if err := a.Set("same password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Set("same password"); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(a.hash) == string(b.hash) {
+		t.Error("two hashes of the same password are equal")
+	}
+}
+
+func TestNeedsRehashAfterParamsChange(t *testing.T) {
+	withPasswordParams(t, testParams)
+
+	var p password
+	if err := p.Set("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	stronger := testParams
+	stronger.Iterations = 2
+	withPasswordParams(t, stronger)
+
+	if !p.NeedsRehash() {
+		t.Error("NeedsRehash = false after the iterations changed")
+	}
+
+	match, err := p.Matches("correct horse")
+	if err != nil || !match {
+		t.Errorf("old hash no longer verifies: %v, %v", match, err)
+	}
+}
+
+func TestLegacyBcrypt(t *testing.T) {
+	withPasswordParams(t, testParams)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("legacy password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := password{hash: hash}
+
+	match, err := p.Matches("legacy password")
+	if err != nil || !match {
+		t.Errorf("Matches(correct) = %v, %v; want true", match, err)
+	}
+
+	match, err = p.Matches("wrong password")
+	if err != nil || match {
+		t.Errorf("Matches(wrong) = %v, %v; want false", match, err)
+	}
+
+	if !p.NeedsRehash() {
+		t.Error("NeedsRehash = false for a bcrypt hash")
+	}
+
+	if err := p.Set("legacy password"); err != nil {
+		t.Fatal(err)
+	}
+	if !isArgon2id(p.hash) || p.NeedsRehash() {
+		t.Errorf("rehashed password is not current argon2id: %q", p.hash)
+	}
+}
+
+func TestDecodeArgon2idRejectsBadHashes(t *testing.T) {
+	const salt = "c29tZXNhbHRzb21lc2FsdA"
+	const key = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"too few parts", "$argon2id$v=19$m=64,t=1,p=1$" + salt},
+		{"wrong version", "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key},
+		{"zero parallelism", "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key},
+		{"zero iterations", "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key},
+		{"parallelism overflow", "$argon2id$v=19$m=64,t=1,p=256$" + salt + "$" + key},
+		{"bad salt", "$argon2id$v=19$m=64,t=1,p=1$!!!$" + key},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := decodeArgon2id([]byte(tt.hash)); err == nil {
+				t.Error("decodeArgon2id accepted the hash")
+			}
+
+			p := password{hash: []byte(tt.hash)}
+			if _, err := p.Matches("anything"); err == nil {
+				t.Error("Matches returned no error")
+			}
+		})
+	}
+
+	_, _, _, err := decodeArgon2id([]byte("$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key))
+	if !errors.Is(err, ErrInvalidHash) {
+		t.Errorf("p=0: err = %v, want ErrInvalidHash", err)
+	}
+}
+
+func TestArgon2ParamsValidate(t *testing.T) {
+	if err := PasswordParams.Validate(); err != nil {
+		t.Errorf("default params are invalid: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(p *Argon2Params)
+	}{
+		{"zero iterations", func(p *Argon2Params) { p.Iterations = 0 }},
+		{"zero parallelism", func(p *Argon2Params) { p.Parallelism = 0 }},
+		{"memory below 8 KiB per lane", func(p *Argon2Params) { p.Memory = 8*uint32(p.Parallelism) - 1 }},
+		{"short salt", func(p *Argon2Params) { p.SaltLength = 4 }},
+		{"short key", func(p *Argon2Params) { p.KeyLength = 2 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := PasswordParams
+			tt.modify(&p)
+
+			if err := p.Validate(); err == nil {
+				t.Error("Validate accepted the params")
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package data
+
+import (
+	"authCRM/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"time"
+)
+
+type PaymentMethod struct {
+	ID                uuid.UUID  `json:"id"`
+	Name              string     `json:"name"`
+	Active            bool       `json:"active"`
+	SortOrder         int        `json:"sort_order"`
+	CommissionPercent *float64   `json:"commission_percent"`
+	ArchivedAt        *time.Time `json:"archived_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	Version           int        `json:"version"`
+}
+
+func ValidatePaymentMethod(v *validator.Validator, pm *PaymentMethod) {
+	v.Check(pm.Name != "", "name", "должны добавить название!")
+	v.Check(len(pm.Name) <= 200, "name", "название не больше 200 байтов!")
+	if pm.CommissionPercent != nil {
+		v.Check(*pm.CommissionPercent >= 0 && *pm.CommissionPercent <= 100, "commission_percent", "комиссия от 0 до 100 процентов")
+	}
+}
+
+// isForeignKeyViolation reports whether err means the row is still referenced
+// from another table.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+type PaymentMethodModel struct {
+	DB *sql.DB
+}
+
+func (m PaymentMethodModel) InsertPaymentMethod(pm *PaymentMethod) error {
+	query := `INSERT INTO payment_method (name, active, sort_order, commission_percent)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, version
+`
+
+	args := []any{pm.Name, pm.Active, pm.SortOrder, pm.CommissionPercent}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&pm.ID, &pm.CreatedAt, &pm.Version)
+}
+
+func (m PaymentMethodModel) GetPaymentMethod(id uuid.UUID) (*PaymentMethod, error) {
+	query := `SELECT id, name, active, sort_order, commission_percent, archived_at, created_at, version
+	FROM payment_method
+	WHERE id = $1
+`
+
+	var pm PaymentMethod
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&pm.ID,
+		&pm.Name,
+		&pm.Active,
+		&pm.SortOrder,
+		&pm.CommissionPercent,
+		&pm.ArchivedAt,
+		&pm.CreatedAt,
+		&pm.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &pm, nil
+}
+
+func (m PaymentMethodModel) UpdatePaymentMethod(pm *PaymentMethod) error {
+	query := `UPDATE payment_method
+	SET name = $1, active = $2, sort_order = $3, commission_percent = $4, version = version + 1
+	WHERE id = $5 AND version = $6
+	RETURNING version
+`
+
+	args := []any{pm.Name, pm.Active, pm.SortOrder, pm.CommissionPercent, pm.ID, pm.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&pm.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeletePaymentMethod removes a method nobody has paid with yet. A method
+// that is referenced by recorded money movements is archived and deactivated
+// instead, so the history keeps pointing at it. The returned flag reports
+// whether it was archived.
+func (m PaymentMethodModel) DeletePaymentMethod(id uuid.UUID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM payment_method WHERE id = $1`, id)
+	if err != nil {
+		if !isForeignKeyViolation(err) {
+			return false, err
+		}
+
+		query := `UPDATE payment_method
+		SET active = false, archived_at = COALESCE(archived_at, NOW()), version = version + 1
+		WHERE id = $1
+	`
+
+		_, err = m.DB.ExecContext(ctx, query, id)
+		if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if rowsAffected == 0 {
+		return false, ErrRecordNotFound
+	}
+
+	return false, nil
+}
+
+func (m PaymentMethodModel) GetAllPaymentMethods(active *bool, includeArchived bool, filters Filters) ([]*PaymentMethod, Metadata, error) {
+	query := `SELECT COUNT(*) OVER(), id, name, active, sort_order, commission_percent, archived_at, created_at, version
+	FROM payment_method
+	WHERE ($1::boolean IS NULL OR active = $1)
+	AND ($2 OR archived_at IS NULL)
+` + filters.orderBy(nil, 3, "id ASC")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, active, includeArchived, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	methods := []*PaymentMethod{}
+
+	for rows.Next() {
+		var pm PaymentMethod
+
+		err := rows.Scan(
+			&totalRecords,
+			&pm.ID,
+			&pm.Name,
+			&pm.Active,
+			&pm.SortOrder,
+			&pm.CommissionPercent,
+			&pm.ArchivedAt,
+			&pm.CreatedAt,
+			&pm.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		methods = append(methods, &pm)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return methods, metadata, nil
+}
@@ -0,0 +1,364 @@
+package data
+
+import (
+	"authCRM/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// SubscriptionIncomeCategoryID is the income category the migration creates
+// for subscription payments. It is used when a payment doesn't name one.
+var SubscriptionIncomeCategoryID = uuid.MustParse("6f1c2b0e-3d4a-4c55-9b7e-1a2f3c4d5e60")
+
+// Payment is money a student paid towards a sold subscription. A subscription
+// can be paid in several installments; every payment posts its own income
+// transaction to the ledger.
+type Payment struct {
+	ID                    uuid.UUID  `json:"id"`
+	StudentSubscriptionID uuid.UUID  `json:"student_subscription_id"`
+	StudentID             uuid.UUID  `json:"student_id"`
+	Amount                int64      `json:"amount"`
+	PaymentMethodID       uuid.UUID  `json:"payment_method_id"`
+	TransactionID         uuid.UUID  `json:"transaction_id"`
+	Date                  time.Time  `json:"date"`
+	Comment               string     `json:"comment"`
+	CreatedBy             *uuid.UUID `json:"created_by"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+// SubscriptionBalance compares what one sold subscription costs the student
+// with what has been paid for it. Charged is the price, or for a cancelled
+// subscription the part of it the student keeps paying for; refunds are
+// taken off what was paid.
+type SubscriptionBalance struct {
+	StudentSubscriptionID uuid.UUID `json:"student_subscription_id"`
+	Name                  string    `json:"name"`
+	StartDate             time.Time `json:"start_date"`
+	Price                 int64     `json:"price"`
+	Charged               int64     `json:"charged"`
+	Paid                  int64     `json:"paid"`
+	Refunded              int64     `json:"refunded"`
+	Debt                  int64     `json:"debt"`
+	Overpayment           int64     `json:"overpayment"`
+}
+
+// StudentBalance nets all of a student's subscriptions against all of their
+// payments, so an overpayment on one plan covers the debt on another.
+type StudentBalance struct {
+	StudentID     uuid.UUID              `json:"student_id"`
+	Charged       int64                  `json:"charged"`
+	Paid          int64                  `json:"paid"`
+	Refunded      int64                  `json:"refunded"`
+	Debt          int64                  `json:"debt"`
+	Overpayment   int64                  `json:"overpayment"`
+	Subscriptions []*SubscriptionBalance `json:"subscriptions"`
+}
+
+type Debtor struct {
+	StudentID   uuid.UUID `json:"student_id"`
+	FullName    string    `json:"full_name"`
+	Debt        int64     `json:"debt"`
+	DaysOverdue int       `json:"days_overdue"`
+}
+
+func ValidatePayment(v *validator.Validator, p *Payment) {
+	v.Check(p.Amount > 0, "amount", "сумма должна быть больше нуля")
+	v.Check(p.PaymentMethodID != uuid.Nil, "payment_method_id", "должны указать способ оплаты!")
+	v.Check(!p.Date.IsZero(), "date", "должны указать дату!")
+	v.Check(len(p.Comment) <= 1000, "comment", "комментарий не больше 1000 байтов!")
+}
+
+// settle splits the difference between what is owed and what was paid into
+// a debt or an overpayment; at most one of them is non-zero.
+func settle(charged, paid int64) (debt, overpayment int64) {
+	if charged > paid {
+		return charged - paid, 0
+	}
+	return 0, paid - charged
+}
+
+type PaymentModel struct {
+	DB *sql.DB
+}
+
+// InsertPayment records the payment and its income transaction in one
+// database transaction, so the ledger never misses a payment. A cancelled
+// subscription is settled and takes no more payments.
+func (m PaymentModel) InsertPayment(p *Payment, categoryID uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var name string
+	var status StudentSubStatus
+
+	query := `SELECT student_id, name, status FROM student_subscriptions WHERE id = $1 FOR UPDATE`
+
+	err = tx.QueryRowContext(ctx, query, p.StudentSubscriptionID).Scan(&p.StudentID, &name, &status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if status == StudentSubCancelled {
+		return ErrAlreadyCancelled
+	}
+
+	t := &Transaction{
+		Direction:       Income,
+		Amount:          p.Amount,
+		CategoryID:      categoryID,
+		PaymentMethodID: p.PaymentMethodID,
+		Date:            p.Date,
+		Comment:         p.Comment,
+		StudentID:       &p.StudentID,
+		CreatedBy:       p.CreatedBy,
+	}
+
+	if t.Comment == "" {
+		t.Comment = fmt.Sprintf("Оплата абонемента «%s»", name)
+	}
+
+	err = insertTransaction(ctx, tx, t)
+	if err != nil {
+		return err
+	}
+
+	p.TransactionID = t.ID
+
+	query = `INSERT INTO payments (student_subscription_id, amount, payment_method_id, transaction_id, date, comment, created_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id, created_at
+`
+
+	args := []any{p.StudentSubscriptionID, p.Amount, p.PaymentMethodID, p.TransactionID, p.Date, p.Comment, p.CreatedBy}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&p.ID, &p.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m PaymentModel) GetAllForSubscription(studentSubscriptionID uuid.UUID) ([]*Payment, error) {
+	query := `SELECT payments.id, payments.student_subscription_id, student_subscriptions.student_id, payments.amount,
+	payments.payment_method_id, payments.transaction_id, payments.date, payments.comment, payments.created_by, payments.created_at
+	FROM payments
+	INNER JOIN student_subscriptions ON student_subscriptions.id = payments.student_subscription_id
+	WHERE payments.student_subscription_id = $1
+	ORDER BY payments.date, payments.created_at
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, studentSubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []*Payment{}
+
+	for rows.Next() {
+		var p Payment
+
+		err := rows.Scan(
+			&p.ID,
+			&p.StudentSubscriptionID,
+			&p.StudentID,
+			&p.Amount,
+			&p.PaymentMethodID,
+			&p.TransactionID,
+			&p.Date,
+			&p.Comment,
+			&p.CreatedBy,
+			&p.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Date = TruncateToDate(p.Date)
+		payments = append(payments, &p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// DeletePayment removes a payment entered by mistake together with its
+// income transaction. Payments of a cancelled subscription are part of its
+// settlement (the refund was worked out from them) and can't be deleted.
+func (m PaymentModel) DeletePayment(id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT student_subscriptions.status
+	FROM payments
+	INNER JOIN student_subscriptions ON student_subscriptions.id = payments.student_subscription_id
+	WHERE payments.id = $1
+	FOR UPDATE OF student_subscriptions
+`
+
+	var status StudentSubStatus
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if status == StudentSubCancelled {
+		return ErrAlreadyCancelled
+	}
+
+	var transactionID uuid.UUID
+
+	err = tx.QueryRowContext(ctx, `DELETE FROM payments WHERE id = $1 RETURNING transaction_id`, id).Scan(&transactionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM transactions WHERE id = $1`, transactionID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m PaymentModel) GetBalance(studentID uuid.UUID) (*StudentBalance, error) {
+	query := `SELECT student_subscriptions.id, student_subscriptions.name, student_subscriptions.start_date,
+	student_subscriptions.price, COALESCE(subscription_cancellations.charged, student_subscriptions.price),
+	(SELECT COALESCE(SUM(amount), 0) FROM payments WHERE payments.student_subscription_id = student_subscriptions.id),
+	COALESCE(subscription_cancellations.refund, 0)
+	FROM student_subscriptions
+	LEFT JOIN subscription_cancellations ON subscription_cancellations.student_subscription_id = student_subscriptions.id
+	WHERE student_subscriptions.student_id = $1
+	ORDER BY student_subscriptions.start_date, student_subscriptions.created_at
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balance := &StudentBalance{
+		StudentID:     studentID,
+		Subscriptions: []*SubscriptionBalance{},
+	}
+
+	for rows.Next() {
+		var sb SubscriptionBalance
+
+		err := rows.Scan(&sb.StudentSubscriptionID, &sb.Name, &sb.StartDate, &sb.Price, &sb.Charged, &sb.Paid, &sb.Refunded)
+		if err != nil {
+			return nil, err
+		}
+
+		sb.StartDate = TruncateToDate(sb.StartDate)
+		sb.Debt, sb.Overpayment = settle(sb.Charged, sb.Paid-sb.Refunded)
+
+		balance.Charged += sb.Charged
+		balance.Paid += sb.Paid
+		balance.Refunded += sb.Refunded
+		balance.Subscriptions = append(balance.Subscriptions, &sb)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	balance.Debt, balance.Overpayment = settle(balance.Charged, balance.Paid-balance.Refunded)
+
+	return balance, nil
+}
+
+// GetDebtors lists the students whose subscriptions cost more than they have
+// paid. Days overdue count from the start of the oldest subscription that is
+// not paid in full.
+func (m PaymentModel) GetDebtors(filters Filters) ([]*Debtor, Metadata, error) {
+	query := fmt.Sprintf(`WITH balances AS (
+		SELECT student_subscriptions.student_id, student_subscriptions.start_date,
+		COALESCE(subscription_cancellations.charged, student_subscriptions.price) AS price,
+		(SELECT COALESCE(SUM(amount), 0) FROM payments WHERE payments.student_subscription_id = student_subscriptions.id)
+		- COALESCE(subscription_cancellations.refund, 0) AS paid
+		FROM student_subscriptions
+		LEFT JOIN subscription_cancellations ON subscription_cancellations.student_subscription_id = student_subscriptions.id
+	)
+	SELECT COUNT(*) OVER(), students.id, students.full_name, SUM(balances.price) - SUM(balances.paid) AS debt,
+	GREATEST(CURRENT_DATE - MIN(balances.start_date) FILTER (WHERE balances.price > balances.paid), 0) AS days_overdue
+	FROM balances
+	INNER JOIN students ON students.id = balances.student_id
+	GROUP BY students.id
+	HAVING SUM(balances.price) > SUM(balances.paid)
+	%s`, filters.orderBy(nil, 1, "days_overdue DESC", "students.id ASC"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	debtors := []*Debtor{}
+
+	for rows.Next() {
+		var d Debtor
+
+		err := rows.Scan(&totalRecords, &d.StudentID, &d.FullName, &d.Debt, &d.DaysOverdue)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		debtors = append(debtors, &d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return debtors, metadata, nil
+}
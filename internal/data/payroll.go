@@ -0,0 +1,717 @@
+package data
+
+import (
+	"authCRM/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"math"
+	"time"
+)
+
+// SalaryExpenseCategoryID is the expense category the migration creates for
+// teacher salaries. Posting a payroll uses it unless another one is given.
+var SalaryExpenseCategoryID = uuid.MustParse("0b7d5e2a-8c1f-4e3b-a6d9-2f4e6a8c0b13")
+
+var (
+	ErrPayrollPosted  = errors.New("payroll is already posted")
+	ErrPayrollOverlap = errors.New("period overlaps a posted payroll")
+)
+
+// PayrollItem is one line of a teacher's pay: a lesson, or a stretch of a
+// month for the fixed scheme. Quantity is the number of attended students
+// or of paid days, Base the lesson revenue a percentage is taken from.
+type PayrollItem struct {
+	ID            uuid.UUID    `json:"id"`
+	TeacherID     *uuid.UUID   `json:"teacher_id"`
+	TeacherName   string       `json:"teacher_name"`
+	SalaryRateID  *uuid.UUID   `json:"salary_rate_id"`
+	Scheme        SalaryScheme `json:"scheme"`
+	LessonID      *uuid.UUID   `json:"lesson_id"`
+	GroupID       *uuid.UUID   `json:"group_id"`
+	Date          time.Time    `json:"date"`
+	Description   string       `json:"description"`
+	Quantity      int          `json:"quantity"`
+	Base          int64        `json:"base"`
+	Amount        int64        `json:"amount"`
+	TransactionID *uuid.UUID   `json:"transaction_id"`
+}
+
+type PayrollTeacher struct {
+	TeacherID     *uuid.UUID     `json:"teacher_id"`
+	TeacherName   string         `json:"teacher_name"`
+	Amount        int64          `json:"amount"`
+	TransactionID *uuid.UUID     `json:"transaction_id"`
+	Items         []*PayrollItem `json:"items"`
+}
+
+// Payroll is the pay of all teachers for a period. It is saved as a draft
+// and, once approved, posted to the ledger as one expense per teacher.
+type Payroll struct {
+	ID         uuid.UUID         `json:"id"`
+	From       time.Time         `json:"period_from"`
+	To         time.Time         `json:"period_to"`
+	Status     PayrollStatus     `json:"status"`
+	Total      int64             `json:"total"`
+	CreatedBy  *uuid.UUID        `json:"created_by"`
+	CreatedAt  time.Time         `json:"created_at"`
+	ApprovedBy *uuid.UUID        `json:"approved_by"`
+	ApprovedAt *time.Time        `json:"approved_at"`
+	Version    int               `json:"version"`
+	Teachers   []*PayrollTeacher `json:"teachers,omitempty"`
+}
+
+func ValidatePayrollPeriod(v *validator.Validator, from, to time.Time) {
+	v.Check(!from.IsZero(), "from", "должны указать дату начала!")
+	v.Check(!to.IsZero(), "to", "должны указать дату окончания!")
+	v.Check(!to.Before(from), "to", "дата окончания раньше даты начала")
+	v.Check(to.Sub(from) <= 366*24*time.Hour, "to", "период не больше года")
+}
+
+// groupByTeacher splits the items into per-teacher blocks, keeping their
+// order, and sums them up.
+func (p *Payroll) groupByTeacher(items []*PayrollItem) {
+	p.Teachers = []*PayrollTeacher{}
+	p.Total = 0
+
+	for _, item := range items {
+		var pt *PayrollTeacher
+		if n := len(p.Teachers); n > 0 && sameTeacher(p.Teachers[n-1].TeacherID, item.TeacherID) {
+			pt = p.Teachers[n-1]
+		} else {
+			pt = &PayrollTeacher{TeacherID: item.TeacherID, TeacherName: item.TeacherName, Items: []*PayrollItem{}}
+			p.Teachers = append(p.Teachers, pt)
+		}
+
+		pt.Items = append(pt.Items, item)
+		pt.Amount += item.Amount
+		pt.TransactionID = item.TransactionID
+		p.Total += item.Amount
+	}
+}
+
+func sameTeacher(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// rateSegment is the part of the period a single rate applies to a teacher.
+type rateSegment struct {
+	teacherID   uuid.UUID
+	teacherName string
+	from, to    time.Time
+	rate        SalaryRate
+}
+
+type payrollLesson struct {
+	id        uuid.UUID
+	groupID   uuid.UUID
+	groupName string
+	teacherID uuid.UUID
+	date      time.Time
+	attended  int
+	revenue   int64
+}
+
+func loadRateSegments(ctx context.Context, db queryer, from, to time.Time) ([]rateSegment, error) {
+	query := `SELECT teachers.id, teachers.full_name, teacher_salary_rates.effective_from,
+	LEAD(teacher_salary_rates.effective_from) OVER (PARTITION BY teacher_salary_rates.teacher_id ORDER BY teacher_salary_rates.effective_from),
+	salary_rates.id, salary_rates.name, salary_rates.scheme, salary_rates.amount, salary_rates.percent
+	FROM teacher_salary_rates
+	INNER JOIN salary_rates ON salary_rates.id = teacher_salary_rates.salary_rate_id
+	INNER JOIN teachers ON teachers.id = teacher_salary_rates.teacher_id
+	ORDER BY teachers.full_name, teachers.id, teacher_salary_rates.effective_from
+`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	segments := []rateSegment{}
+
+	for rows.Next() {
+		var s rateSegment
+		var next *time.Time
+
+		err := rows.Scan(&s.teacherID, &s.teacherName, &s.from, &next, &s.rate.ID, &s.rate.Name, &s.rate.Scheme, &s.rate.Amount, &s.rate.Percent)
+		if err != nil {
+			return nil, err
+		}
+
+		s.from = TruncateToDate(s.from)
+		if s.from.Before(from) {
+			s.from = from
+		}
+
+		s.to = to
+		if next != nil && TruncateToDate(*next).AddDate(0, 0, -1).Before(to) {
+			s.to = TruncateToDate(*next).AddDate(0, 0, -1)
+		}
+
+		if s.from.After(s.to) {
+			continue
+		}
+
+		segments = append(segments, s)
+	}
+
+	return segments, rows.Err()
+}
+
+// loadPayrollLessons returns the conducted lessons of the period with the
+// number of students who came and the revenue of the lesson. A visit is worth
+// the snapshot price per session for 'количество' plans. For 'период' plans
+// the price is spread over the days of the term (freezes excluded): a visit
+// earns the days since the previous charged visit on the subscription, or
+// since its start. That depends only on earlier visits, so a lesson's revenue
+// doesn't change once it is paid, and the visits never earn more than the
+// price.
+func loadPayrollLessons(ctx context.Context, db queryer, from, to time.Time) ([]payrollLesson, error) {
+	query := `WITH visits AS (
+		SELECT attendance.id, attendance.student_subscription_id,
+		LEAST(lessons.date, student_subscriptions.end_date) AS date,
+		COALESCE(LAG(LEAST(lessons.date, student_subscriptions.end_date)) OVER (
+			PARTITION BY attendance.student_subscription_id ORDER BY lessons.starts_at, lessons.id
+		), student_subscriptions.start_date - 1) AS prev_date
+		FROM attendance
+		INNER JOIN lessons ON lessons.id = attendance.lesson_id
+		INNER JOIN student_subscriptions ON student_subscriptions.id = attendance.student_subscription_id
+		WHERE attendance.status = ANY($3::attendance_status[])
+		AND student_subscriptions.type <> $5 AND lessons.status = $6
+	),
+	period_visits AS (
+		SELECT visits.id,
+		student_subscriptions.price::numeric * GREATEST(visits.date - visits.prev_date - (
+			SELECT COALESCE(SUM(GREATEST(LEAST(end_date, visits.date) - GREATEST(start_date, visits.prev_date + 1) + 1, 0)), 0)
+			FROM subscription_freezes WHERE student_subscription_id = visits.student_subscription_id
+		), 0) / NULLIF(student_subscriptions.end_date - student_subscriptions.start_date + 1 - (
+			SELECT COALESCE(SUM(end_date - start_date + 1), 0)
+			FROM subscription_freezes WHERE student_subscription_id = visits.student_subscription_id
+		), 0) AS revenue
+		FROM visits
+		INNER JOIN student_subscriptions ON student_subscriptions.id = visits.student_subscription_id
+	)
+	SELECT lessons.id, lessons.group_id, groups.name, lessons.teacher_id, lessons.date,
+	COUNT(attendance.id) FILTER (WHERE attendance.status = ANY($4::attendance_status[])),
+	ROUND(COALESCE(SUM(
+		CASE WHEN student_subscriptions.type = $5
+		THEN student_subscriptions.price::numeric / NULLIF(student_subscriptions.sessions_count, 0)
+		ELSE period_visits.revenue
+		END
+	) FILTER (WHERE attendance.status = ANY($3::attendance_status[])), 0))::bigint
+	FROM lessons
+	INNER JOIN groups ON groups.id = lessons.group_id
+	LEFT JOIN attendance ON attendance.lesson_id = lessons.id
+	LEFT JOIN student_subscriptions ON student_subscriptions.id = attendance.student_subscription_id
+	LEFT JOIN period_visits ON period_visits.id = attendance.id
+	WHERE lessons.status = $6 AND lessons.teacher_id IS NOT NULL
+	AND lessons.date BETWEEN $1 AND $2
+	GROUP BY lessons.id, groups.name
+	ORDER BY lessons.starts_at, lessons.id
+`
+
+	chargeable := pq.Array([]string{string(AttendancePresent), string(AttendanceLate), string(AttendanceUnexcused)})
+	attended := pq.Array([]string{string(AttendancePresent), string(AttendanceLate)})
+
+	rows, err := db.QueryContext(ctx, query, from, to, chargeable, attended, Visits, LessonConducted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lessons := []payrollLesson{}
+
+	for rows.Next() {
+		var l payrollLesson
+
+		err := rows.Scan(&l.id, &l.groupID, &l.groupName, &l.teacherID, &l.date, &l.attended, &l.revenue)
+		if err != nil {
+			return nil, err
+		}
+
+		l.date = TruncateToDate(l.date)
+		lessons = append(lessons, l)
+	}
+
+	return lessons, rows.Err()
+}
+
+// calculatePayroll builds the itemized pay of every teacher who has a rate
+// in the period. Lessons of teachers without a rate are not paid.
+func calculatePayroll(ctx context.Context, db queryer, from, to time.Time) ([]*PayrollItem, error) {
+	segments, err := loadRateSegments(ctx, db, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	lessons, err := loadPayrollLessons(ctx, db, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return payrollItems(segments, lessons), nil
+}
+
+// payrollItems pays each rate segment for its days or for the lessons its
+// teacher gave while the rate was in effect.
+func payrollItems(segments []rateSegment, lessons []payrollLesson) []*PayrollItem {
+	items := []*PayrollItem{}
+
+	for _, s := range segments {
+		base := PayrollItem{
+			TeacherID:    &s.teacherID,
+			TeacherName:  s.teacherName,
+			SalaryRateID: &s.rate.ID,
+			Scheme:       s.rate.Scheme,
+		}
+
+		var amount int64
+		var percent float64
+
+		if s.rate.Amount != nil {
+			amount = *s.rate.Amount
+		}
+
+		if s.rate.Percent != nil {
+			percent = *s.rate.Percent
+		}
+
+		if s.rate.Scheme == SalaryFixed {
+			items = append(items, fixedItems(base, s.from, s.to, amount)...)
+			continue
+		}
+
+		for _, l := range lessons {
+			if l.teacherID != s.teacherID || l.date.Before(s.from) || l.date.After(s.to) {
+				continue
+			}
+
+			item := base
+			item.LessonID = &l.id
+			item.GroupID = &l.groupID
+			item.Date = l.date
+
+			switch s.rate.Scheme {
+			case SalaryPerLesson:
+				item.Description = fmt.Sprintf("Урок в группе «%s»", l.groupName)
+				item.Quantity = 1
+				item.Amount = amount
+			case SalaryPerStudent:
+				item.Description = fmt.Sprintf("Урок в группе «%s», учеников: %d", l.groupName, l.attended)
+				item.Quantity = l.attended
+				item.Amount = amount * int64(l.attended)
+			case SalaryRevenueShare:
+				item.Description = fmt.Sprintf("%g%% выручки урока в группе «%s»", percent, l.groupName)
+				item.Quantity = l.attended
+				item.Base = l.revenue
+				item.Amount = int64(math.Round(float64(l.revenue) * percent / 100))
+			}
+
+			items = append(items, &item)
+		}
+	}
+
+	return items
+}
+
+// fixedItems pays the monthly salary for the days of every calendar month
+// between from and to.
+func fixedItems(base PayrollItem, from, to time.Time, monthly int64) []*PayrollItem {
+	items := []*PayrollItem{}
+
+	for start := from; !start.After(to); {
+		monthEnd := time.Date(start.Year(), start.Month()+1, 0, 0, 0, 0, 0, time.UTC)
+		end := monthEnd
+		if to.Before(end) {
+			end = to
+		}
+
+		days := int(end.Sub(start).Hours()/24) + 1
+		daysInMonth := monthEnd.Day()
+
+		item := base
+		item.Date = start
+		item.Description = fmt.Sprintf("Оклад с %s по %s (%d из %d дн.)", start.Format("02.01.2006"), end.Format("02.01.2006"), days, daysInMonth)
+		item.Quantity = days
+		item.Amount = int64(math.Round(float64(monthly) * float64(days) / float64(daysInMonth)))
+
+		items = append(items, &item)
+
+		start = monthEnd.AddDate(0, 0, 1)
+	}
+
+	return items
+}
+
+type PayrollModel struct {
+	DB *sql.DB
+}
+
+// overlapsPostedPayroll gives a friendly early answer; two payrolls posted at
+// the same time are caught by the payrolls_posted_overlap_excl constraint.
+func overlapsPostedPayroll(ctx context.Context, tx *sql.Tx, id uuid.UUID, from, to time.Time) (bool, error) {
+	query := `SELECT EXISTS (
+		SELECT 1 FROM payrolls
+		WHERE status = $1 AND id <> $2 AND period_from <= $4 AND period_to >= $3
+	)`
+
+	var overlap bool
+	err := tx.QueryRowContext(ctx, query, PayrollPosted, id, from, to).Scan(&overlap)
+
+	return overlap, err
+}
+
+// CreatePayroll calculates the pay for the period and saves it as a draft.
+// Periods already paid by a posted payroll are refused so no lesson is paid
+// twice.
+func (m PayrollModel) CreatePayroll(p *Payroll) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	overlap, err := overlapsPostedPayroll(ctx, tx, uuid.Nil, p.From, p.To)
+	if err != nil {
+		return err
+	}
+
+	if overlap {
+		return ErrPayrollOverlap
+	}
+
+	items, err := calculatePayroll(ctx, tx, p.From, p.To)
+	if err != nil {
+		return err
+	}
+
+	p.Status = PayrollDraft
+	p.groupByTeacher(items)
+
+	query := `INSERT INTO payrolls (period_from, period_to, status, total, created_by)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at, version
+`
+
+	err = tx.QueryRowContext(ctx, query, p.From, p.To, p.Status, p.Total, p.CreatedBy).Scan(&p.ID, &p.CreatedAt, &p.Version)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO payroll_items (payroll_id, teacher_id, teacher_name, salary_rate_id, scheme, lesson_id, group_id, date,
+	description, quantity, base, amount)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	RETURNING id
+`
+
+	for _, item := range items {
+		args := []any{p.ID, item.TeacherID, item.TeacherName, item.SalaryRateID, item.Scheme, item.LessonID, item.GroupID, item.Date,
+			item.Description, item.Quantity, item.Base, item.Amount}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&item.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+const payrollColumns = `id, period_from, period_to, status, total, created_by, created_at, approved_by, approved_at, version`
+
+func scanPayroll(row rowScanner, p *Payroll) error {
+	err := row.Scan(
+		&p.ID,
+		&p.From,
+		&p.To,
+		&p.Status,
+		&p.Total,
+		&p.CreatedBy,
+		&p.CreatedAt,
+		&p.ApprovedBy,
+		&p.ApprovedAt,
+		&p.Version,
+	)
+	if err != nil {
+		return err
+	}
+
+	p.From = TruncateToDate(p.From)
+	p.To = TruncateToDate(p.To)
+
+	return nil
+}
+
+func (m PayrollModel) GetPayroll(id uuid.UUID) (*Payroll, error) {
+	query := `SELECT ` + payrollColumns + `
+	FROM payrolls
+	WHERE id = $1
+`
+
+	var p Payroll
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := scanPayroll(m.DB.QueryRowContext(ctx, query, id), &p)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `SELECT id, teacher_id, teacher_name, salary_rate_id, scheme, lesson_id, group_id, date, description, quantity, base,
+	amount, transaction_id
+	FROM payroll_items
+	WHERE payroll_id = $1
+	ORDER BY teacher_name, teacher_id, date, id
+`
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*PayrollItem{}
+
+	for rows.Next() {
+		var item PayrollItem
+
+		err := rows.Scan(
+			&item.ID,
+			&item.TeacherID,
+			&item.TeacherName,
+			&item.SalaryRateID,
+			&item.Scheme,
+			&item.LessonID,
+			&item.GroupID,
+			&item.Date,
+			&item.Description,
+			&item.Quantity,
+			&item.Base,
+			&item.Amount,
+			&item.TransactionID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		item.Date = TruncateToDate(item.Date)
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	total := p.Total
+	p.groupByTeacher(items)
+	p.Total = total
+
+	return &p, nil
+}
+
+func (m PayrollModel) GetAllPayrolls(status *PayrollStatus, filters Filters) ([]*Payroll, Metadata, error) {
+	query := fmt.Sprintf(`SELECT COUNT(*) OVER(), %s
+	FROM payrolls
+	WHERE ($1::payroll_status IS NULL OR status = $1)
+	%s`, payrollColumns, filters.orderBy(nil, 2, "id ASC"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	payrolls := []*Payroll{}
+
+	for rows.Next() {
+		var p Payroll
+
+		err := rows.Scan(
+			&totalRecords,
+			&p.ID,
+			&p.From,
+			&p.To,
+			&p.Status,
+			&p.Total,
+			&p.CreatedBy,
+			&p.CreatedAt,
+			&p.ApprovedBy,
+			&p.ApprovedAt,
+			&p.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		p.From = TruncateToDate(p.From)
+		p.To = TruncateToDate(p.To)
+		payrolls = append(payrolls, &p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return payrolls, metadata, nil
+}
+
+// DeletePayroll discards a draft. Posted payrolls are part of the books and
+// can't be deleted.
+func (m PayrollModel) DeletePayroll(id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var status PayrollStatus
+
+	err := m.DB.QueryRowContext(ctx, `SELECT status FROM payrolls WHERE id = $1`, id).Scan(&status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if status != PayrollDraft {
+		return ErrPayrollPosted
+	}
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM payrolls WHERE id = $1 AND status = $2`, id, PayrollDraft)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrPayrollPosted
+	}
+
+	return nil
+}
+
+// PostPayroll approves a draft and writes one expense transaction per
+// teacher with a non-zero amount, linking the teacher's items to it.
+func (m PayrollModel) PostPayroll(p *Payroll, paymentMethodID, categoryID, approvedBy uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status PayrollStatus
+	var version int
+
+	err = tx.QueryRowContext(ctx, `SELECT status, version FROM payrolls WHERE id = $1 FOR UPDATE`, p.ID).Scan(&status, &version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	switch {
+	case status != PayrollDraft:
+		return ErrPayrollPosted
+	case version != p.Version:
+		return ErrEditConflict
+	}
+
+	overlap, err := overlapsPostedPayroll(ctx, tx, p.ID, p.From, p.To)
+	if err != nil {
+		return err
+	}
+
+	if overlap {
+		return ErrPayrollOverlap
+	}
+
+	for _, pt := range p.Teachers {
+		if pt.Amount == 0 {
+			continue
+		}
+
+		t := &Transaction{
+			Direction:       Expense,
+			Amount:          pt.Amount,
+			CategoryID:      categoryID,
+			PaymentMethodID: paymentMethodID,
+			Date:            TruncateToDate(time.Now()),
+			Comment:         fmt.Sprintf("Зарплата: %s, %s – %s", pt.TeacherName, p.From.Format("02.01.2006"), p.To.Format("02.01.2006")),
+			TeacherID:       pt.TeacherID,
+			CreatedBy:       &approvedBy,
+		}
+
+		err = insertTransaction(ctx, tx, t)
+		if err != nil {
+			return err
+		}
+
+		query := `UPDATE payroll_items
+		SET transaction_id = $1
+		WHERE payroll_id = $2 AND teacher_id IS NOT DISTINCT FROM $3
+	`
+
+		_, err = tx.ExecContext(ctx, query, t.ID, p.ID, pt.TeacherID)
+		if err != nil {
+			return err
+		}
+
+		pt.TransactionID = &t.ID
+		for _, item := range pt.Items {
+			item.TransactionID = &t.ID
+		}
+	}
+
+	query := `UPDATE payrolls
+	SET status = $1, approved_by = $2, approved_at = NOW(), version = version + 1
+	WHERE id = $3
+	RETURNING approved_at, version
+`
+
+	err = tx.QueryRowContext(ctx, query, PayrollPosted, approvedBy, p.ID).Scan(&p.ApprovedAt, &p.Version)
+	if err != nil {
+		switch {
+		case isExclusionViolation(err):
+			return ErrPayrollOverlap
+		default:
+			return err
+		}
+	}
+
+	p.Status = PayrollPosted
+	p.ApprovedBy = &approvedBy
+
+	return tx.Commit()
+}
@@ -0,0 +1,8 @@
+package data
+
+type PayrollStatus string
+
+const (
+	PayrollDraft  PayrollStatus = "черновик"
+	PayrollPosted PayrollStatus = "проведен"
+)
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"github.com/google/uuid"
+	"testing"
+)
+
+func TestFixedItems(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		monthly  int64
+		want     []int64
+		days     []int
+	}{
+		{"whole month", "2026-02-01", "2026-02-28", 31000, []int64{31000}, []int{28}},
+		{"leap february", "2028-02-01", "2028-02-29", 29000, []int64{29000}, []int{29}},
+		{"split across months", "2026-01-15", "2026-03-10", 31000, []int64{17000, 31000, 10000}, []int{17, 28, 10}},
+		{"single day", "2026-04-30", "2026-04-30", 30000, []int64{1000}, []int{1}},
+		{"rounded", "2026-04-01", "2026-04-10", 1000, []int64{333}, []int{10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := fixedItems(PayrollItem{Scheme: SalaryFixed}, parseDate(tt.from), parseDate(tt.to), tt.monthly)
+
+			if len(items) != len(tt.want) {
+				t.Fatalf("got %d items, want %d", len(items), len(tt.want))
+			}
+
+			for i, item := range items {
+				if item.Amount != tt.want[i] || item.Quantity != tt.days[i] {
+					t.Errorf("item %d: amount %d for %d days, want %d for %d days", i, item.Amount, item.Quantity, tt.want[i], tt.days[i])
+				}
+				if item.Scheme != SalaryFixed {
+					t.Errorf("item %d: scheme = %q", i, item.Scheme)
+				}
+			}
+
+			if first := items[0].Date; !first.Equal(parseDate(tt.from)) {
+				t.Errorf("first item dated %s, want %s", first.Format("2006-01-02"), tt.from)
+			}
+		})
+	}
+}
+
+func TestPayrollItems(t *testing.T) {
+	perLesson, perStudent := int64(500), int64(100)
+	percent := 12.5
+
+	t1, t2, t3 := uuid.New(), uuid.New(), uuid.New()
+
+	segments := []rateSegment{
+		{teacherID: t1, from: parseDate("2026-01-01"), to: parseDate("2026-01-15"), rate: SalaryRate{Scheme: SalaryPerLesson, Amount: &perLesson}},
+		{teacherID: t1, from: parseDate("2026-01-16"), to: parseDate("2026-01-31"), rate: SalaryRate{Scheme: SalaryPerStudent, Amount: &perStudent}},
+		{teacherID: t2, from: parseDate("2026-01-01"), to: parseDate("2026-01-31"), rate: SalaryRate{Scheme: SalaryRevenueShare, Percent: &percent}},
+	}
+
+	lessons := []payrollLesson{
+		{id: uuid.New(), teacherID: t1, date: parseDate("2026-01-10"), attended: 4, revenue: 2000},
+		{id: uuid.New(), teacherID: t1, date: parseDate("2026-01-20"), attended: 3, revenue: 1500},
+		{id: uuid.New(), teacherID: t2, date: parseDate("2026-01-20"), attended: 2, revenue: 1004},
+		{id: uuid.New(), teacherID: t3, date: parseDate("2026-01-20"), attended: 5, revenue: 2500},
+		{id: uuid.New(), teacherID: t2, date: parseDate("2026-02-01"), attended: 2, revenue: 1000},
+	}
+
+	want := []struct {
+		lesson   uuid.UUID
+		scheme   SalaryScheme
+		quantity int
+		base     int64
+		amount   int64
+	}{
+		{lessons[0].id, SalaryPerLesson, 1, 0, 500},
+		{lessons[1].id, SalaryPerStudent, 3, 0, 300},
+		{lessons[2].id, SalaryRevenueShare, 2, 1004, 126},
+	}
+
+	items := payrollItems(segments, lessons)
+
+	if len(items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(items), len(want))
+	}
+
+	for i, w := range want {
+		item := items[i]
+
+		if item.LessonID == nil || *item.LessonID != w.lesson {
+			t.Errorf("item %d: lesson = %v, want %v", i, item.LessonID, w.lesson)
+		}
+		if item.Scheme != w.scheme || item.Quantity != w.quantity || item.Base != w.base || item.Amount != w.amount {
+			t.Errorf("item %d: %q x%d base %d = %d, want %q x%d base %d = %d",
+				i, item.Scheme, item.Quantity, item.Base, item.Amount, w.scheme, w.quantity, w.base, w.amount)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"time"
+)
+
+type Permissions []string
+
+func (p Permissions) Include(code string) bool {
+	for i := range p {
+		if code == p[i] {
+			return true
+		}
+	}
+	return false
+}
+
+type PermissionModel struct {
+	DB *sql.DB
+}
+
+func (m PermissionModel) GetAllForUser(userID uuid.UUID) (Permissions, error) {
+	query := `SELECT permissions.code
+	FROM permissions
+	INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+	INNER JOIN users ON users_permissions.user_id = users.id
+	WHERE users.id = $1
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// GrantRole sets the user's role and replaces their permissions with the
+// ones that belong to the role.
+func (m PermissionModel) GrantRole(user *User, role Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = grantRole(ctx, tx, user, role)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func grantRole(ctx context.Context, tx *sql.Tx, user *User, role Role) error {
+	err := setUserRole(ctx, tx, user, &role)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO users_permissions
+	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+`
+
+	_, err = tx.ExecContext(ctx, query, user.ID, pq.Array(RolePermissions[role]))
+	return err
+}
+
+// RevokeRole clears the user's role and removes all of their permissions.
+func (m PermissionModel) RevokeRole(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = setUserRole(ctx, tx, user, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func setUserRole(ctx context.Context, tx *sql.Tx, user *User, role *Role) error {
+	query := `UPDATE users
+	SET role = $1, version = version + 1
+	WHERE id = $2 AND version = $3
+	RETURNING version
+`
+
+	err := tx.QueryRowContext(ctx, query, role, user.ID, user.Version).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	user.Role = role
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM users_permissions WHERE user_id = $1`, user.ID)
+	return err
+}
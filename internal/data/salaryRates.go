@@ -0,0 +1,295 @@
+package data
+
+import (
+	"authCRM/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	ErrSalaryRateInUse    = errors.New("salary rate is assigned to a teacher")
+	ErrDuplicateRateStart = errors.New("teacher already has a salary rate starting on this date")
+)
+
+// SalaryRate is a pay scheme that can be assigned to teachers. Percent is
+// set for the revenue share scheme, Amount for all the others: per month,
+// per lesson or per attended student.
+type SalaryRate struct {
+	ID        uuid.UUID    `json:"id"`
+	Name      string       `json:"name"`
+	Scheme    SalaryScheme `json:"scheme"`
+	Amount    *int64       `json:"amount"`
+	Percent   *float64     `json:"percent"`
+	CreatedAt time.Time    `json:"created_at"`
+	Version   int          `json:"version"`
+}
+
+// TeacherSalaryRate assigns a rate to a teacher from EffectiveFrom until the
+// next assignment starts.
+type TeacherSalaryRate struct {
+	ID            uuid.UUID    `json:"id"`
+	TeacherID     uuid.UUID    `json:"teacher_id"`
+	SalaryRateID  uuid.UUID    `json:"salary_rate_id"`
+	Name          string       `json:"name,omitempty"`
+	Scheme        SalaryScheme `json:"scheme,omitempty"`
+	EffectiveFrom time.Time    `json:"effective_from"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+func ValidateSalaryRate(v *validator.Validator, sr *SalaryRate) {
+	v.Check(sr.Name != "", "name", "должны добавить название!")
+	v.Check(len(sr.Name) <= 200, "name", "название не больше 200 байтов!")
+	v.Check(validator.PermittedValue(sr.Scheme, SalaryFixed, SalaryPerLesson, SalaryPerStudent, SalaryRevenueShare), "scheme", "неверная схема оплаты")
+
+	if sr.Scheme == SalaryRevenueShare {
+		v.Check(sr.Percent != nil, "percent", "должны указать процент!")
+		v.Check(sr.Amount == nil, "amount", "для процента от выручки сумма не указывается")
+		if sr.Percent != nil {
+			v.Check(*sr.Percent >= 0 && *sr.Percent <= 100, "percent", "процент от 0 до 100")
+		}
+		return
+	}
+
+	v.Check(sr.Amount != nil, "amount", "должны указать сумму!")
+	v.Check(sr.Percent == nil, "percent", "процент указывается только для процента от выручки")
+	if sr.Amount != nil {
+		v.Check(*sr.Amount >= 0, "amount", "сумма не может быть отрицательной")
+	}
+}
+
+func ValidateTeacherSalaryRate(v *validator.Validator, a *TeacherSalaryRate) {
+	v.Check(a.SalaryRateID != uuid.Nil, "salary_rate_id", "должны указать ставку!")
+	v.Check(!a.EffectiveFrom.IsZero(), "effective_from", "должны указать дату начала!")
+}
+
+type SalaryRateModel struct {
+	DB *sql.DB
+}
+
+func (m SalaryRateModel) InsertSalaryRate(sr *SalaryRate) error {
+	query := `INSERT INTO salary_rates (name, scheme, amount, percent)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, version
+`
+
+	args := []any{sr.Name, sr.Scheme, sr.Amount, sr.Percent}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&sr.ID, &sr.CreatedAt, &sr.Version)
+}
+
+func (m SalaryRateModel) GetSalaryRate(id uuid.UUID) (*SalaryRate, error) {
+	query := `SELECT id, name, scheme, amount, percent, created_at, version
+	FROM salary_rates
+	WHERE id = $1
+`
+
+	var sr SalaryRate
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&sr.ID,
+		&sr.Name,
+		&sr.Scheme,
+		&sr.Amount,
+		&sr.Percent,
+		&sr.CreatedAt,
+		&sr.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &sr, nil
+}
+
+// UpdateSalaryRate changes the rate for every teacher it is assigned to.
+// Payrolls already calculated keep the amounts they were built with.
+func (m SalaryRateModel) UpdateSalaryRate(sr *SalaryRate) error {
+	query := `UPDATE salary_rates
+	SET name = $1, scheme = $2, amount = $3, percent = $4, version = version + 1
+	WHERE id = $5 AND version = $6
+	RETURNING version
+`
+
+	args := []any{sr.Name, sr.Scheme, sr.Amount, sr.Percent, sr.ID, sr.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&sr.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m SalaryRateModel) DeleteSalaryRate(id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM salary_rates WHERE id = $1`, id)
+	if err != nil {
+		switch {
+		case isForeignKeyViolation(err):
+			return ErrSalaryRateInUse
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m SalaryRateModel) GetAllSalaryRates() ([]*SalaryRate, error) {
+	query := `SELECT id, name, scheme, amount, percent, created_at, version
+	FROM salary_rates
+	ORDER BY name, id
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []*SalaryRate{}
+
+	for rows.Next() {
+		var sr SalaryRate
+
+		err := rows.Scan(
+			&sr.ID,
+			&sr.Name,
+			&sr.Scheme,
+			&sr.Amount,
+			&sr.Percent,
+			&sr.CreatedAt,
+			&sr.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		rates = append(rates, &sr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
+
+func (m SalaryRateModel) AssignSalaryRate(a *TeacherSalaryRate) error {
+	query := `INSERT INTO teacher_salary_rates (teacher_id, salary_rate_id, effective_from)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, a.TeacherID, a.SalaryRateID, a.EffectiveFrom).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "teacher_salary_rates_teacher_id_effective_from_key"`:
+			return ErrDuplicateRateStart
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAssignments returns the teacher's rate history, the latest first.
+func (m SalaryRateModel) GetAssignments(teacherID uuid.UUID) ([]*TeacherSalaryRate, error) {
+	query := `SELECT teacher_salary_rates.id, teacher_salary_rates.teacher_id, teacher_salary_rates.salary_rate_id,
+	salary_rates.name, salary_rates.scheme, teacher_salary_rates.effective_from, teacher_salary_rates.created_at
+	FROM teacher_salary_rates
+	INNER JOIN salary_rates ON salary_rates.id = teacher_salary_rates.salary_rate_id
+	WHERE teacher_salary_rates.teacher_id = $1
+	ORDER BY teacher_salary_rates.effective_from DESC
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []*TeacherSalaryRate{}
+
+	for rows.Next() {
+		var a TeacherSalaryRate
+
+		err := rows.Scan(&a.ID, &a.TeacherID, &a.SalaryRateID, &a.Name, &a.Scheme, &a.EffectiveFrom, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		a.EffectiveFrom = TruncateToDate(a.EffectiveFrom)
+		assignments = append(assignments, &a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return assignments, nil
+}
+
+func (m SalaryRateModel) DeleteAssignment(teacherID, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM teacher_salary_rates WHERE id = $1 AND teacher_id = $2`, id, teacherID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
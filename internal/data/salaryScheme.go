@@ -0,0 +1,10 @@
+package data
+
+type SalaryScheme string
+
+const (
+	SalaryFixed        SalaryScheme = "оклад"
+	SalaryPerLesson    SalaryScheme = "за урок"
+	SalaryPerStudent   SalaryScheme = "за ученика"
+	SalaryRevenueShare SalaryScheme = "процент от выручки"
+)
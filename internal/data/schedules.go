@@ -0,0 +1,695 @@
+package data
+
+import (
+	"authCRM/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Schedule is a weekly recurrence rule for a group's lessons. Weekdays use
+// ISO numbering (1 is Monday, 7 is Sunday); start and end times are "HH:MM"
+// wall clock times in Timezone.
+type Schedule struct {
+	ID            uuid.UUID   `json:"id"`
+	GroupID       uuid.UUID   `json:"group_id"`
+	TeacherID     *uuid.UUID  `json:"teacher_id"`
+	CabinetID     *uuid.UUID  `json:"cabinet_id"`
+	Weekdays      []int32     `json:"weekdays"`
+	StartTime     string      `json:"start_time"`
+	EndTime       string      `json:"end_time"`
+	IntervalWeeks int         `json:"interval_weeks"`
+	Timezone      string      `json:"timezone"`
+	StartsOn      time.Time   `json:"starts_on"`
+	Until         *time.Time  `json:"until"`
+	Exceptions    []time.Time `json:"exceptions"`
+	CreatedAt     time.Time   `json:"created_at"`
+	Version       int         `json:"version"`
+}
+
+type occurrence struct {
+	date     time.Time
+	startsAt time.Time
+	endsAt   time.Time
+}
+
+func ValidateSchedule(v *validator.Validator, s *Schedule) {
+	v.Check(len(s.Weekdays) > 0, "weekdays", "должны указать дни недели!")
+	v.Check(validator.Unique(s.Weekdays), "weekdays", "дни недели не должны повторяться")
+	for _, day := range s.Weekdays {
+		v.Check(day >= 1 && day <= 7, "weekdays", "дни недели от 1 (понедельник) до 7 (воскресенье)")
+	}
+
+	start, err := time.Parse("15:04", s.StartTime)
+	v.Check(err == nil, "start_time", "время в формате ЧЧ:ММ")
+	end, err := time.Parse("15:04", s.EndTime)
+	v.Check(err == nil, "end_time", "время в формате ЧЧ:ММ")
+	v.Check(end.After(start), "end_time", "время окончания раньше времени начала")
+
+	v.Check(s.IntervalWeeks >= 1 && s.IntervalWeeks <= 52, "interval_weeks", "интервал от 1 до 52 недель")
+
+	_, err = time.LoadLocation(s.Timezone)
+	v.Check(s.Timezone != "" && err == nil, "timezone", "неизвестный часовой пояс")
+
+	v.Check(!s.StartsOn.IsZero(), "starts_on", "должны указать дату начала!")
+	if s.Until != nil {
+		v.Check(!s.Until.Before(s.StartsOn), "until", "дата окончания раньше даты начала")
+	}
+}
+
+// ValidateGenerationRange caps how far ahead lessons can be generated in one
+// run; a typo in a year shouldn't fill the table with decades of lessons.
+func ValidateGenerationRange(v *validator.Validator, from, to time.Time) {
+	v.Check(!from.IsZero(), "from", "должны указать дату начала!")
+	v.Check(!to.IsZero(), "to", "должны указать дату окончания!")
+	v.Check(!to.Before(from), "to", "дата окончания раньше даты начала")
+	v.Check(to.Sub(from) <= 366*24*time.Hour, "to", "период не больше года")
+}
+
+// occurrences lists the lessons the rule produces between from and to, both
+// dates included. The interval is counted in calendar weeks from the week
+// that contains StartsOn.
+func (s *Schedule) occurrences(from, to time.Time) []occurrence {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	start, _ := time.Parse("15:04", s.StartTime)
+	end, _ := time.Parse("15:04", s.EndTime)
+
+	first := TruncateToDate(from)
+	if first.Before(s.StartsOn) {
+		first = s.StartsOn
+	}
+
+	last := TruncateToDate(to)
+	if s.Until != nil && s.Until.Before(last) {
+		last = *s.Until
+	}
+
+	days := make(map[int32]bool, len(s.Weekdays))
+	for _, day := range s.Weekdays {
+		days[day] = true
+	}
+
+	skip := make(map[time.Time]bool, len(s.Exceptions))
+	for _, date := range s.Exceptions {
+		skip[date] = true
+	}
+
+	anchor := weekStart(s.StartsOn)
+	occurrences := []occurrence{}
+
+	for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+		if !days[isoWeekday(d)] || skip[d] {
+			continue
+		}
+
+		weeks := int(weekStart(d).Sub(anchor).Hours()/24) / 7
+		if weeks%s.IntervalWeeks != 0 {
+			continue
+		}
+
+		occurrences = append(occurrences, occurrence{
+			date:     d,
+			startsAt: time.Date(d.Year(), d.Month(), d.Day(), start.Hour(), start.Minute(), 0, 0, loc),
+			endsAt:   time.Date(d.Year(), d.Month(), d.Day(), end.Hour(), end.Minute(), 0, 0, loc),
+		})
+	}
+
+	return occurrences
+}
+
+func isoWeekday(d time.Time) int32 {
+	if d.Weekday() == time.Sunday {
+		return 7
+	}
+	return int32(d.Weekday())
+}
+
+func weekStart(d time.Time) time.Time {
+	return d.AddDate(0, 0, -int(isoWeekday(d)-1))
+}
+
+type ScheduleModel struct {
+	DB *sql.DB
+}
+
+const scheduleColumns = `schedules.id, schedules.group_id, schedules.teacher_id, schedules.cabinet_id, schedules.weekdays,
+	to_char(schedules.start_time, 'HH24:MI'), to_char(schedules.end_time, 'HH24:MI'), schedules.interval_weeks,
+	schedules.timezone, schedules.starts_on, schedules.until, schedules.created_at, schedules.version`
+
+func scanSchedule(row rowScanner, s *Schedule) error {
+	err := row.Scan(
+		&s.ID,
+		&s.GroupID,
+		&s.TeacherID,
+		&s.CabinetID,
+		pq.Array(&s.Weekdays),
+		&s.StartTime,
+		&s.EndTime,
+		&s.IntervalWeeks,
+		&s.Timezone,
+		&s.StartsOn,
+		&s.Until,
+		&s.CreatedAt,
+		&s.Version,
+	)
+	if err != nil {
+		return err
+	}
+
+	s.StartsOn = TruncateToDate(s.StartsOn)
+	if s.Until != nil {
+		until := TruncateToDate(*s.Until)
+		s.Until = &until
+	}
+
+	return nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func loadExceptions(ctx context.Context, db queryer, s *Schedule) error {
+	query := `SELECT date FROM schedule_exceptions
+	WHERE schedule_id = $1
+	ORDER BY date
+`
+
+	rows, err := db.QueryContext(ctx, query, s.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	s.Exceptions = []time.Time{}
+
+	for rows.Next() {
+		var date time.Time
+
+		err := rows.Scan(&date)
+		if err != nil {
+			return err
+		}
+
+		s.Exceptions = append(s.Exceptions, TruncateToDate(date))
+	}
+
+	return rows.Err()
+}
+
+func insertSchedule(ctx context.Context, tx *sql.Tx, s *Schedule) error {
+	query := `INSERT INTO schedules (group_id, teacher_id, cabinet_id, weekdays, start_time, end_time, interval_weeks, timezone, starts_on, until)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	RETURNING id, created_at, version
+`
+
+	args := []any{s.GroupID, s.TeacherID, s.CabinetID, pq.Array(s.Weekdays), s.StartTime, s.EndTime, s.IntervalWeeks, s.Timezone, s.StartsOn, s.Until}
+
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&s.ID, &s.CreatedAt, &s.Version)
+	if err != nil {
+		return err
+	}
+
+	for _, date := range s.Exceptions {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schedule_exceptions (schedule_id, date) VALUES ($1, $2) ON CONFLICT DO NOTHING`, s.ID, date)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GenerationResult reports what a generator run did. Occurrences that would
+// double-book a cabinet or a teacher are not created and are listed in
+// Skipped instead, so one clash doesn't stop the rest of the range.
+type GenerationResult struct {
+	Created int             `json:"created"`
+	Skipped []SkippedLesson `json:"skipped"`
+}
+
+type SkippedLesson struct {
+	ScheduleID uuid.UUID `json:"schedule_id"`
+	GroupID    uuid.UUID `json:"group_id"`
+	Date       time.Time `json:"date"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+}
+
+// generate materializes the rule's lessons between from and to. A rule makes
+// at most one lesson per date, so dates that already have a lesson (even one
+// that was moved or cancelled) are left alone. An occurrence that clashes
+// with another lesson in the cabinet or for the teacher is skipped; each
+// insert runs under a savepoint so the clash doesn't abort the transaction.
+func generate(ctx context.Context, tx *sql.Tx, s *Schedule, from, to time.Time, result *GenerationResult) error {
+	query := `INSERT INTO lessons (group_id, schedule_id, teacher_id, cabinet_id, date, starts_at, ends_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (schedule_id, date) DO NOTHING
+`
+
+	for _, o := range s.occurrences(from, to) {
+		_, err := tx.ExecContext(ctx, `SAVEPOINT generate_lesson`)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, query, s.GroupID, s.ID, s.TeacherID, s.CabinetID, o.date, o.startsAt, o.endsAt)
+		if err != nil {
+			if !isExclusionViolation(err) {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT generate_lesson`)
+			if err != nil {
+				return err
+			}
+
+			result.Skipped = append(result.Skipped, SkippedLesson{
+				ScheduleID: s.ID,
+				GroupID:    s.GroupID,
+				Date:       o.date,
+				StartsAt:   o.startsAt,
+				EndsAt:     o.endsAt,
+			})
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, `RELEASE SAVEPOINT generate_lesson`)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 1 {
+			result.Created++
+		}
+	}
+
+	return nil
+}
+
+// dropPlanned removes the rule's lessons that haven't happened yet from the
+// given date on, and returns the last date it removed so the caller can
+// regenerate the same stretch.
+func dropPlanned(ctx context.Context, tx *sql.Tx, scheduleID uuid.UUID, from time.Time) (*time.Time, error) {
+	query := `WITH deleted AS (
+		DELETE FROM lessons
+		WHERE schedule_id = $1 AND date >= $2 AND status = $3
+		RETURNING date
+	)
+	SELECT MAX(date) FROM deleted
+`
+
+	var last *time.Time
+
+	err := tx.QueryRowContext(ctx, query, scheduleID, from, LessonPlanned).Scan(&last)
+	if err != nil {
+		return nil, err
+	}
+
+	return last, nil
+}
+
+func (m ScheduleModel) InsertSchedule(s *Schedule) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertSchedule(ctx, tx, s)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m ScheduleModel) GetSchedule(id uuid.UUID) (*Schedule, error) {
+	query := `SELECT ` + scheduleColumns + `
+	FROM schedules
+	WHERE id = $1
+`
+
+	var s Schedule
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := scanSchedule(m.DB.QueryRowContext(ctx, query, id), &s)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = loadExceptions(ctx, m.DB, &s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (m ScheduleModel) GetAllForGroup(groupID uuid.UUID) ([]*Schedule, error) {
+	query := `SELECT ` + scheduleColumns + `
+	FROM schedules
+	WHERE group_id = $1
+	ORDER BY starts_on, id
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []*Schedule{}
+
+	for rows.Next() {
+		var s Schedule
+
+		err := scanSchedule(rows, &s)
+		if err != nil {
+			return nil, err
+		}
+
+		schedules = append(schedules, &s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, s := range schedules {
+		err = loadExceptions(ctx, m.DB, s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return schedules, nil
+}
+
+// UpdateSchedule changes the whole rule. Lessons that are still planned from
+// the given date on are dropped and generated again with the new settings;
+// conducted and cancelled lessons are kept as they were.
+func (m ScheduleModel) UpdateSchedule(s *Schedule, from time.Time) (*GenerationResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE schedules
+	SET teacher_id = $1, cabinet_id = $2, weekdays = $3, start_time = $4, end_time = $5, interval_weeks = $6,
+	timezone = $7, starts_on = $8, until = $9, version = version + 1
+	WHERE id = $10 AND version = $11
+	RETURNING version
+`
+
+	args := []any{s.TeacherID, s.CabinetID, pq.Array(s.Weekdays), s.StartTime, s.EndTime, s.IntervalWeeks, s.Timezone, s.StartsOn, s.Until, s.ID, s.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&s.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrEditConflict
+		default:
+			return nil, err
+		}
+	}
+
+	result := &GenerationResult{Skipped: []SkippedLesson{}}
+
+	err = replan(ctx, tx, s, from, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, tx.Commit()
+}
+
+// SplitSchedule applies an edit to "this and following" lessons: the current
+// rule is cut off the day before from, and next takes over from that date
+// with the exceptions that fall into its range.
+func (m ScheduleModel) SplitSchedule(current, next *Schedule, from time.Time) (*GenerationResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	until := from.AddDate(0, 0, -1)
+
+	query := `UPDATE schedules
+	SET until = $1, version = version + 1
+	WHERE id = $2 AND version = $3
+	RETURNING version
+`
+
+	err = tx.QueryRowContext(ctx, query, until, current.ID, current.Version).Scan(&current.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrEditConflict
+		default:
+			return nil, err
+		}
+	}
+
+	current.Until = &until
+
+	next.GroupID = current.GroupID
+	next.StartsOn = from
+	next.Exceptions = []time.Time{}
+	kept := []time.Time{}
+	for _, date := range current.Exceptions {
+		if date.Before(from) {
+			kept = append(kept, date)
+		} else {
+			next.Exceptions = append(next.Exceptions, date)
+		}
+	}
+	current.Exceptions = kept
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM schedule_exceptions WHERE schedule_id = $1 AND date >= $2`, current.ID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertSchedule(ctx, tx, next)
+	if err != nil {
+		return nil, err
+	}
+
+	last, err := dropPlanned(ctx, tx, current.ID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GenerationResult{Skipped: []SkippedLesson{}}
+
+	if last != nil {
+		err = generate(ctx, tx, next, from, *last, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, tx.Commit()
+}
+
+func replan(ctx context.Context, tx *sql.Tx, s *Schedule, from time.Time, result *GenerationResult) error {
+	last, err := dropPlanned(ctx, tx, s.ID, from)
+	if err != nil {
+		return err
+	}
+
+	if last == nil {
+		return nil
+	}
+
+	return generate(ctx, tx, s, from, *last, result)
+}
+
+// DeleteSchedule stops the rule. With a nil from the rule is removed
+// altogether; otherwise it ends the day before from. Either way planned
+// lessons it no longer covers are removed, past ones stay.
+func (m ScheduleModel) DeleteSchedule(s *Schedule, from *time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if from == nil || !from.After(s.StartsOn) {
+		dropFrom := TruncateToDate(time.Now())
+		if from != nil {
+			dropFrom = *from
+		}
+
+		_, err = dropPlanned(ctx, tx, s.ID, dropFrom)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM schedules WHERE id = $1`, s.ID)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}
+
+	until := from.AddDate(0, 0, -1)
+
+	result, err := tx.ExecContext(ctx, `UPDATE schedules SET until = $1, version = version + 1 WHERE id = $2 AND version = $3`, until, s.ID, s.Version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	_, err = dropPlanned(ctx, tx, s.ID, *from)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddException skips the rule on one date and removes the lesson already
+// generated for it, unless that lesson has been conducted.
+func (m ScheduleModel) AddException(s *Schedule, date time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO schedule_exceptions (schedule_id, date) VALUES ($1, $2) ON CONFLICT DO NOTHING`, s.ID, date)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM lessons WHERE schedule_id = $1 AND date = $2 AND status = $3`, s.ID, date, LessonPlanned)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	s.Exceptions = append(s.Exceptions, date)
+
+	return nil
+}
+
+// Generate creates the lessons of every rule (or only the group's rules)
+// between from and to. Running it again over the same range creates nothing
+// new, so it is safe to call from cron as well as from the API.
+func (m ScheduleModel) Generate(from, to time.Time, groupID *uuid.UUID) (*GenerationResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Rules never produce lessons past the end date of their group, so the
+	// group's end date is folded into until here.
+	query := `SELECT schedules.id, schedules.group_id, schedules.teacher_id, schedules.cabinet_id, schedules.weekdays,
+	to_char(schedules.start_time, 'HH24:MI'), to_char(schedules.end_time, 'HH24:MI'), schedules.interval_weeks,
+	schedules.timezone, schedules.starts_on, LEAST(schedules.until, groups.end_date), schedules.created_at, schedules.version
+	FROM schedules
+	INNER JOIN groups ON groups.id = schedules.group_id
+	WHERE ($1::uuid IS NULL OR schedules.group_id = $1)
+	AND schedules.starts_on <= $3
+	AND (schedules.until IS NULL OR schedules.until >= $2)
+	ORDER BY schedules.starts_on, schedules.id
+`
+
+	rows, err := tx.QueryContext(ctx, query, groupID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := []*Schedule{}
+
+	for rows.Next() {
+		var s Schedule
+
+		err := scanSchedule(rows, &s)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		schedules = append(schedules, &s)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &GenerationResult{Skipped: []SkippedLesson{}}
+
+	for _, s := range schedules {
+		err = loadExceptions(ctx, tx, s)
+		if err != nil {
+			return nil, err
+		}
+
+		err = generate(ctx, tx, s, from, to, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, tx.Commit()
+}
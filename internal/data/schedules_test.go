@@ -0,0 +1,108 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleOccurrences(t *testing.T) {
+	until := parseDate("2026-10-12")
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		from, to string
+		want     []string
+	}{
+		{
+			name:     "weekly",
+			schedule: Schedule{Weekdays: []int32{1, 3}, IntervalWeeks: 1, StartsOn: parseDate("2026-10-05")},
+			from:     "2026-10-01", to: "2026-10-18",
+			want: []string{"2026-10-05", "2026-10-07", "2026-10-12", "2026-10-14"},
+		},
+		{
+			name:     "every other week from the week of starts_on",
+			schedule: Schedule{Weekdays: []int32{1, 3}, IntervalWeeks: 2, StartsOn: parseDate("2026-10-07")},
+			from:     "2026-10-01", to: "2026-10-25",
+			want: []string{"2026-10-07", "2026-10-19", "2026-10-21"},
+		},
+		{
+			name:     "exceptions are skipped",
+			schedule: Schedule{Weekdays: []int32{1, 3}, IntervalWeeks: 1, StartsOn: parseDate("2026-10-05"), Exceptions: []time.Time{parseDate("2026-10-12")}},
+			from:     "2026-10-05", to: "2026-10-18",
+			want: []string{"2026-10-05", "2026-10-07", "2026-10-14"},
+		},
+		{
+			name:     "stops at until",
+			schedule: Schedule{Weekdays: []int32{1, 3}, IntervalWeeks: 1, StartsOn: parseDate("2026-10-05"), Until: &until},
+			from:     "2026-10-01", to: "2026-10-31",
+			want: []string{"2026-10-05", "2026-10-07", "2026-10-12"},
+		},
+		{
+			name:     "sunday is 7",
+			schedule: Schedule{Weekdays: []int32{7}, IntervalWeeks: 1, StartsOn: parseDate("2026-10-01")},
+			from:     "2026-10-01", to: "2026-10-14",
+			want: []string{"2026-10-04", "2026-10-11"},
+		},
+		{
+			name:     "range before starts_on",
+			schedule: Schedule{Weekdays: []int32{1}, IntervalWeeks: 1, StartsOn: parseDate("2026-11-02")},
+			from:     "2026-10-01", to: "2026-10-31",
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.schedule
+			s.StartTime, s.EndTime, s.Timezone = "10:00", "11:30", "UTC"
+
+			got := []string{}
+			for _, o := range s.occurrences(parseDate(tt.from), parseDate(tt.to)) {
+				got = append(got, o.date.Format(time.DateOnly))
+
+				if d := o.endsAt.Sub(o.startsAt); d != 90*time.Minute {
+					t.Errorf("%s lasts %v, want 1h30m", o.date.Format(time.DateOnly), d)
+				}
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("occurrences = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("occurrences = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestScheduleOccurrencesKeepWallClockTime(t *testing.T) {
+	s := Schedule{
+		Weekdays:      []int32{6, 1},
+		StartTime:     "10:00",
+		EndTime:       "11:00",
+		IntervalWeeks: 1,
+		Timezone:      "Europe/Berlin",
+		StartsOn:      parseDate("2026-10-01"),
+	}
+
+	// Summer time ends on 2026-10-25; the lesson stays at 10:00 local time.
+	want := map[string]string{
+		"2026-10-24": "2026-10-24T08:00:00Z",
+		"2026-10-26": "2026-10-26T09:00:00Z",
+	}
+
+	occurrences := s.occurrences(parseDate("2026-10-24"), parseDate("2026-10-26"))
+	if len(occurrences) != len(want) {
+		t.Fatalf("got %d occurrences, want %d", len(occurrences), len(want))
+	}
+
+	for _, o := range occurrences {
+		date := o.date.Format(time.DateOnly)
+		if got := o.startsAt.UTC().Format(time.RFC3339); got != want[date] {
+			t.Errorf("%s starts at %s, want %s", date, got, want[date])
+		}
+	}
+}
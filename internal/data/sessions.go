@@ -0,0 +1,133 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Session is an authentication token as seen by its owner.
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expiry     time.Time  `json:"expiry"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	Current    bool       `json:"current"`
+}
+
+// NewSession issues an authentication token and remembers where it was
+// issued from.
+func (t TokenModel) NewSession(userID uuid.UUID, ttl time.Duration, ip, userAgent string) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO tokens (hash, user_id, expiry, scope, ip, user_agent)
+	VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, ip, userAgent}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = t.DB.ExecContext(ctx, query, args...)
+	return token, err
+}
+
+// Touch records that the session was used. The row is only written when the
+// stored value is older than staleAfter, so busy clients don't cause a write
+// on every request.
+func (t TokenModel) Touch(tokenPlaintext string, staleAfter time.Duration) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `UPDATE tokens
+	SET last_used_at = NOW()
+	WHERE hash = $1
+	AND (last_used_at IS NULL OR last_used_at < $2)
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.DB.ExecContext(ctx, query, tokenHash[:], time.Now().Add(-staleAfter))
+	return err
+}
+
+func (t TokenModel) GetAllSessionsForUser(userID uuid.UUID, currentPlaintext string) ([]*Session, error) {
+	query := `SELECT id, hash, created_at, last_used_at, expiry, COALESCE(ip, ''), COALESCE(user_agent, '')
+	FROM tokens
+	WHERE user_id = $1 AND scope = $2 AND expiry > NOW()
+	ORDER BY created_at DESC
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, userID, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	currentHash := sha256.Sum256([]byte(currentPlaintext))
+	sessions := []*Session{}
+
+	for rows.Next() {
+		var session Session
+		var hash []byte
+
+		err := rows.Scan(
+			&session.ID,
+			&hash,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.IP,
+			&session.UserAgent,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		session.Current = bytes.Equal(hash, currentHash[:])
+
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (t TokenModel) DeleteSession(id, userID uuid.UUID) error {
+	query := `DELETE FROM tokens
+	WHERE id = $1 AND user_id = $2 AND scope = $3
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := t.DB.ExecContext(ctx, query, id, userID, ScopeAuthentication)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -1 +1,9 @@
 package data
+
+type StudentStatus string
+
+const (
+	StudentActive   StudentStatus = "активный"
+	StudentArchived StudentStatus = "архивный"
+	StudentFrozen   StudentStatus = "заморожен"
+)
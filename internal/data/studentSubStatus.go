@@ -0,0 +1,11 @@
+package data
+
+type StudentSubStatus string
+
+const (
+	StudentSubActive    StudentSubStatus = "активный"
+	StudentSubExpired   StudentSubStatus = "истек"
+	StudentSubExhausted StudentSubStatus = "исчерпан"
+	StudentSubFrozen    StudentSubStatus = "заморожен"
+	StudentSubCancelled StudentSubStatus = "отменен"
+)
@@ -1 +1,196 @@
 package data
+
+import (
+	"authCRM/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+type Student struct {
+	ID          uuid.UUID     `json:"id"`
+	CreatedAt   time.Time     `json:"created_at"`
+	FullName    string        `json:"full_name"`
+	Gender      Gender        `json:"gender"`
+	Phone       string        `json:"phone"`
+	ParentPhone string        `json:"parent_phone"`
+	Status      StudentStatus `json:"status"`
+	Note        string        `json:"note"`
+	Version     int           `json:"version"`
+}
+
+func ValidateStudent(v *validator.Validator, student *Student) {
+	v.Check(student.FullName != "", "name", "должны добавить имя!")
+	v.Check(len(student.FullName) <= 200, "name", "имя не больше 200 байтов!")
+	v.Check(student.Phone != "" || student.ParentPhone != "", "phone", "должны добавить телефон ученика или родителя!")
+	v.Check(validator.PermittedValue(student.Gender, Male, Female), "gender", "неизвестный пол")
+	v.Check(validator.PermittedValue(student.Status, StudentActive, StudentArchived, StudentFrozen), "status", "неизвестный статус")
+}
+
+type StudentModel struct {
+	DB *sql.DB
+}
+
+func (s StudentModel) InsertStudent(student *Student) error {
+	query := `INSERT INTO students (full_name, gender, phoneNumber, parentNumber, status, note)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at, version
+`
+
+	args := []any{student.FullName, student.Gender, student.Phone, student.ParentPhone, student.Status, student.Note}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return s.DB.QueryRowContext(ctx, query, args...).Scan(&student.ID, &student.CreatedAt, &student.Version)
+}
+
+func (s StudentModel) GetStudent(id uuid.UUID) (*Student, error) {
+	query := `SELECT id, created_at, full_name, gender, COALESCE(phoneNumber, ''), COALESCE(parentNumber, ''), status, COALESCE(note, ''), version
+	FROM students
+	WHERE id = $1
+	`
+
+	var student Student
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, query, id).Scan(
+		&student.ID,
+		&student.CreatedAt,
+		&student.FullName,
+		&student.Gender,
+		&student.Phone,
+		&student.ParentPhone,
+		&student.Status,
+		&student.Note,
+		&student.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &student, err
+}
+
+func (s StudentModel) UpdateStudent(student *Student) error {
+	query := `UPDATE students
+	SET full_name = $1, gender = $2, phoneNumber = $3, parentNumber = $4, status = $5, note = $6, version = version + 1
+	WHERE id = $7 and version = $8
+	RETURNING version
+`
+
+	args := []any{student.FullName, student.Gender, student.Phone, student.ParentPhone, student.Status, student.Note, student.ID, student.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, query, args...).Scan(&student.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+
+		}
+	}
+	return nil
+}
+
+func (s StudentModel) DeleteStudent(id uuid.UUID) error {
+	query := `DELETE FROM students
+	WHERE id = $1
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		switch {
+		case isForeignKeyViolation(err):
+			return ErrStudentHasSubscriptions
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+
+}
+
+func (s StudentModel) GetAllStudents(search string, gender *Gender, status *StudentStatus, filters Filters) ([]*Student, Metadata, error) {
+	query := fmt.Sprintf(`SELECT COUNT(*) OVER(), id, created_at, full_name, gender, COALESCE(phoneNumber, ''), COALESCE(parentNumber, ''), status, COALESCE(note, ''), version
+FROM students
+WHERE (to_tsvector('simple', full_name) @@ plainto_tsquery('simple', $1)
+    OR phoneNumber ILIKE '%%' || $1 || '%%'
+    OR parentNumber ILIKE '%%' || $1 || '%%'
+    OR $1 = '')
+  AND ($2::gender IS NULL OR gender = $2::gender)
+  AND ($3::student_status IS NULL OR status = $3::student_status)
+%s`, filters.orderBy(nil, 4, "id ASC"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, search, gender, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	students := []*Student{}
+
+	for rows.Next() {
+		var student Student
+
+		err := rows.Scan(
+			&totalRecords,
+			&student.ID,
+			&student.CreatedAt,
+			&student.FullName,
+			&student.Gender,
+			&student.Phone,
+			&student.ParentPhone,
+			&student.Status,
+			&student.Note,
+			&student.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		students = append(students, &student)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return students, metadata, nil
+}
@@ -9,16 +9,22 @@ import (
 	"time"
 )
 
+var (
+	ErrSubscriptionSold = errors.New("subscription has been sold and can only be archived")
+)
+
 type Subscription struct {
-	ID             uuid.UUID `json:"id"`
-	Name           string    `json:"name"`
-	Price          int32     `json:"price"`
-	Type           SubStatus `json:"type"`
-	DurationMonths *int16    `json:"duration_months,omitempty"`
-	SessionsCount  *int16    `json:"sessions_count,omitempty"`
-	ValidityMonths *int16    `json:"validity_months,omitempty"`
-	CreatedAt      time.Time `json:"-"`
-	UpdatedAt      time.Time `json:"-"`
+	ID             uuid.UUID  `json:"id"`
+	Name           string     `json:"name"`
+	Price          int32      `json:"price"`
+	Type           SubStatus  `json:"type"`
+	DurationMonths *int16     `json:"duration_months,omitempty"`
+	SessionsCount  *int16     `json:"sessions_count,omitempty"`
+	ValidityMonths *int16     `json:"validity_months,omitempty"`
+	MaxFreezeDays  *int16     `json:"max_freeze_days,omitempty"`
+	ArchivedAt     *time.Time `json:"archived_at,omitempty"`
+	CreatedAt      time.Time  `json:"-"`
+	UpdatedAt      time.Time  `json:"-"`
 }
 
 func getValue(v *int16) int16 {
@@ -33,6 +39,7 @@ func ValidateSubscription(v *validator.Validator, sub *Subscription) {
 	v.Check(len(sub.Name) <= 200, "name", "имя не больше 200 байтов!")
 	v.Check(sub.Type != "", "type", "должны выбрать тип!")
 	v.Check(sub.Price > 0, "price", "сумма должна быть больше нуля!")
+	v.Check(getValue(sub.MaxFreezeDays) >= 0, "max_freeze_days", "не может быть отрицательным")
 
 	if sub.Type == Monthly {
 		v.Check(getValue(sub.ValidityMonths) == 0, "validMonths", "такой параметр не для периодной подписки")
@@ -49,12 +56,12 @@ type SubModel struct {
 
 func (s SubModel) InsertSubscription(sub *Subscription) error {
 
-	query := `INSERT INTO subscriptions (name, price, type, duration_months, sessions_count, validity_months)
-	VALUES ($1, $2, $3, $4, $5, $6)
+	query := `INSERT INTO subscriptions (name, price, type, duration_months, sessions_count, validity_months, max_freeze_days)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
 	RETURNING id, created_at
 `
 
-	args := []any{sub.Name, sub.Price, sub.Type, sub.DurationMonths, sub.SessionsCount, sub.ValidityMonths}
+	args := []any{sub.Name, sub.Price, sub.Type, sub.DurationMonths, sub.SessionsCount, sub.ValidityMonths, sub.MaxFreezeDays}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -63,7 +70,7 @@ func (s SubModel) InsertSubscription(sub *Subscription) error {
 }
 
 func (s SubModel) GetSubscription(id uuid.UUID) (*Subscription, error) {
-	query := `SELECT id, name, price, type, duration_months, sessions_count, validity_months, updated_at
+	query := `SELECT id, name, price, type, duration_months, sessions_count, validity_months, max_freeze_days, archived_at, updated_at
 	FROM subscriptions
 	WHERE id = $1
 	`
@@ -82,6 +89,8 @@ func (s SubModel) GetSubscription(id uuid.UUID) (*Subscription, error) {
 		&sub.DurationMonths,
 		&sub.SessionsCount,
 		&sub.ValidityMonths,
+		&sub.MaxFreezeDays,
+		&sub.ArchivedAt,
 		&sub.UpdatedAt,
 	)
 
@@ -99,14 +108,14 @@ func (s SubModel) GetSubscription(id uuid.UUID) (*Subscription, error) {
 
 func (s SubModel) UpdateSubscription(sub *Subscription) error {
 	query := `UPDATE subscriptions
-	SET name = $1, price = $2, type = $3, duration_months = $4, sessions_count = $5, validity_months = $6, updated_at = NOW()
-	WHERE id = $7 and updated_at = $8
+	SET name = $1, price = $2, type = $3, duration_months = $4, sessions_count = $5, validity_months = $6, max_freeze_days = $7, updated_at = NOW()
+	WHERE id = $8 and updated_at = $9
 	RETURNING updated_at
 `
 
 	updatedAt := sub.UpdatedAt.UTC().Truncate(time.Microsecond)
 
-	args := []any{sub.Name, sub.Price, sub.Type, sub.DurationMonths, sub.SessionsCount, sub.ValidityMonths, sub.ID, updatedAt}
+	args := []any{sub.Name, sub.Price, sub.Type, sub.DurationMonths, sub.SessionsCount, sub.ValidityMonths, sub.MaxFreezeDays, sub.ID, updatedAt}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -124,10 +133,61 @@ func (s SubModel) UpdateSubscription(sub *Subscription) error {
 	return nil
 }
 
+// ArchiveSubscription takes the plan out of the catalog. Sold subscriptions
+// keep pointing at it, and it can be restored later.
+func (s SubModel) ArchiveSubscription(sub *Subscription) error {
+	query := `UPDATE subscriptions
+	SET archived_at = COALESCE(archived_at, NOW()), updated_at = NOW()
+	WHERE id = $1
+	RETURNING archived_at, updated_at
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, query, sub.ID).Scan(&sub.ArchivedAt, &sub.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s SubModel) RestoreSubscription(sub *Subscription) error {
+	query := `UPDATE subscriptions
+	SET archived_at = NULL, updated_at = NOW()
+	WHERE id = $1
+	RETURNING updated_at
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, query, sub.ID).Scan(&sub.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	sub.ArchivedAt = nil
+
+	return nil
+}
+
+// DeleteSubscription removes a plan for good. Only plans that were never
+// sold can go; the rest must be archived.
 func (s SubModel) DeleteSubscription(id uuid.UUID) error {
 	query := `DELETE FROM subscriptions
 	WHERE id = $1
-
 `
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -135,7 +195,12 @@ func (s SubModel) DeleteSubscription(id uuid.UUID) error {
 
 	result, err := s.DB.ExecContext(ctx, query, id)
 	if err != nil {
-		return err
+		switch {
+		case isForeignKeyViolation(err):
+			return ErrSubscriptionSold
+		default:
+			return err
+		}
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -148,18 +213,35 @@ func (s SubModel) DeleteSubscription(id uuid.UUID) error {
 	}
 
 	return nil
+}
 
+type SubscriptionFilter struct {
+	Name            string
+	Type            *SubStatus
+	MinPrice        *int32
+	MaxPrice        *int32
+	IncludeArchived bool
 }
 
-func (s SubModel) GetAllSubscriptions() ([]*Subscription, error) {
-	query := `SELECT COUNT(*) OVER(), id, name, price, type FROM subscriptions`
+func (s SubModel) GetAllSubscriptions(sf SubscriptionFilter, filters Filters) ([]*Subscription, Metadata, error) {
+	query := `SELECT COUNT(*) OVER(), id, name, price, type, duration_months, sessions_count, validity_months,
+	max_freeze_days, archived_at, created_at, updated_at
+	FROM subscriptions
+	WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+	AND ($2::sub_status IS NULL OR type = $2)
+	AND ($3::int IS NULL OR price >= $3)
+	AND ($4::int IS NULL OR price <= $4)
+	AND ($5 OR archived_at IS NULL)
+` + filters.orderBy(nil, 6, "id ASC")
+
+	args := []any{sf.Name, sf.Type, sf.MinPrice, sf.MaxPrice, sf.IncludeArchived, filters.limit(), filters.offset()}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := s.DB.QueryContext(ctx, query)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 
 	defer rows.Close()
@@ -176,17 +258,26 @@ func (s SubModel) GetAllSubscriptions() ([]*Subscription, error) {
 			&sub.Name,
 			&sub.Price,
 			&sub.Type,
+			&sub.DurationMonths,
+			&sub.SessionsCount,
+			&sub.ValidityMonths,
+			&sub.MaxFreezeDays,
+			&sub.ArchivedAt,
+			&sub.CreatedAt,
+			&sub.UpdatedAt,
 		)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 
 		subs = append(subs, &sub)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 
-	return subs, nil
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return subs, metadata, nil
 }
@@ -19,7 +19,7 @@ type Teacher struct {
 	Status       TeacherStatus `json:"status"`
 	CreatedAt    time.Time     `json:"-"`
 	UpdatedAt    time.Time     `json:"-"`
-	SalaryRateID int32         `json:"salary_rate_id"`
+	SalaryRateID *uuid.UUID    `json:"salary_rate_id"`
 }
 
 func ValidateTeacher(v *validator.Validator, teacher *Teacher) {
@@ -47,7 +47,10 @@ func (t TeacherModel) InsertTeacher(teacher *Teacher) error {
 }
 
 func (t TeacherModel) GetTeacher(id uuid.UUID) (*Teacher, error) {
-	query := `SELECT id, full_name, birth_date, phone, note, status, updated_at, gender
+	query := `SELECT id, full_name, birth_date, phone, note, status, updated_at, gender,
+	(SELECT salary_rate_id FROM teacher_salary_rates
+	 WHERE teacher_id = teachers.id AND effective_from <= CURRENT_DATE
+	 ORDER BY effective_from DESC LIMIT 1)
 	FROM teachers
 	WHERE id = $1
 	`
@@ -67,6 +70,7 @@ func (t TeacherModel) GetTeacher(id uuid.UUID) (*Teacher, error) {
 		&teacher.Status,
 		&teacher.UpdatedAt,
 		&teacher.Gender,
+		&teacher.SalaryRateID,
 	)
 
 	if err != nil {
@@ -134,13 +138,15 @@ func (t TeacherModel) DeleteTeacher(id uuid.UUID) error {
 }
 
 func (t TeacherModel) GetAllTeachers(name string, gender *Gender, status *TeacherStatus, filters Filters) ([]*Teacher, Metadata, error) {
-	query := `SELECT COUNT(*) OVER(), id, full_name, birth_date, phone, status, gender
+	query := `SELECT COUNT(*) OVER(), id, full_name, birth_date, phone, status, gender,
+(SELECT salary_rate_id FROM teacher_salary_rates
+ WHERE teacher_id = teachers.id AND effective_from <= CURRENT_DATE
+ ORDER BY effective_from DESC LIMIT 1)
 FROM teachers
 WHERE (to_tsvector('simple', full_name) @@ plainto_tsquery('simple', $1) OR $1 = '')
   AND ($2::gender IS NULL OR gender = $2::gender)
   AND ($3::teacher_status IS NULL OR status = $3::teacher_status)
-ORDER BY id
-LIMIT $4 OFFSET $5`
+` + filters.orderBy(sortColumns{"name": "full_name"}, 4, "id ASC")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -166,6 +172,7 @@ LIMIT $4 OFFSET $5`
 			&teacher.Phone,
 			&teacher.Status,
 			&teacher.Gender,
+			&teacher.SalaryRateID,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
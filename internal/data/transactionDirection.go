@@ -0,0 +1,8 @@
+package data
+
+type TransactionDirection string
+
+const (
+	Income  TransactionDirection = "приход"
+	Expense TransactionDirection = "расход"
+)
@@ -0,0 +1,263 @@
+package data
+
+import (
+	"authCRM/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	ErrTransactionLinked = errors.New("transaction was posted by a payment, payroll or refund")
+)
+
+// Transaction is one entry of the cash ledger. Amounts are whole currency
+// units, the same as subscription prices, and always positive; Direction says
+// whether money came in or went out.
+type Transaction struct {
+	ID              uuid.UUID            `json:"id"`
+	Direction       TransactionDirection `json:"direction"`
+	Amount          int64                `json:"amount"`
+	CategoryID      uuid.UUID            `json:"category_id"`
+	PaymentMethodID uuid.UUID            `json:"payment_method_id"`
+	Date            time.Time            `json:"date"`
+	Comment         string               `json:"comment"`
+	StudentID       *uuid.UUID           `json:"student_id"`
+	TeacherID       *uuid.UUID           `json:"teacher_id"`
+	CreatedBy       *uuid.UUID           `json:"created_by"`
+	CreatedAt       time.Time            `json:"created_at"`
+}
+
+type TransactionFilter struct {
+	From            *time.Time
+	To              *time.Time
+	Direction       *TransactionDirection
+	CategoryID      *uuid.UUID
+	PaymentMethodID *uuid.UUID
+	StudentID       *uuid.UUID
+	TeacherID       *uuid.UUID
+}
+
+// Totals sums up the transactions matched by a filter, not just one page.
+type Totals struct {
+	Income  int64 `json:"income"`
+	Expense int64 `json:"expense"`
+	Balance int64 `json:"balance"`
+}
+
+func ValidateTransaction(v *validator.Validator, t *Transaction) {
+	v.Check(validator.PermittedValue(t.Direction, Income, Expense), "direction", "направление: приход или расход")
+	v.Check(t.Amount > 0, "amount", "сумма должна быть больше нуля")
+	v.Check(t.CategoryID != uuid.Nil, "category_id", "должны указать статью!")
+	v.Check(t.PaymentMethodID != uuid.Nil, "payment_method_id", "должны указать способ оплаты!")
+	v.Check(!t.Date.IsZero(), "date", "должны указать дату!")
+	v.Check(len(t.Comment) <= 1000, "comment", "комментарий не больше 1000 байтов!")
+}
+
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// insertTransaction writes a ledger entry. It takes either the pool or a
+// transaction, so payments, payroll and refunds can post their entry in the
+// same database transaction as the change that caused it.
+func insertTransaction(ctx context.Context, db rowQueryer, t *Transaction) error {
+	var incomeItemID, expenseItemID *uuid.UUID
+
+	switch t.Direction {
+	case Income:
+		incomeItemID = &t.CategoryID
+	case Expense:
+		expenseItemID = &t.CategoryID
+	}
+
+	query := `INSERT INTO transactions (direction, amount, income_item_id, expense_item_id, payment_method_id, date, comment,
+	student_id, teacher_id, created_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	RETURNING id, created_at
+`
+
+	args := []any{t.Direction, t.Amount, incomeItemID, expenseItemID, t.PaymentMethodID, t.Date, t.Comment,
+		t.StudentID, t.TeacherID, t.CreatedBy}
+
+	return db.QueryRowContext(ctx, query, args...).Scan(&t.ID, &t.CreatedAt)
+}
+
+type TransactionModel struct {
+	DB *sql.DB
+}
+
+func (m TransactionModel) InsertTransaction(t *Transaction) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertTransaction(ctx, m.DB, t)
+}
+
+const transactionColumns = `transactions.id, transactions.direction, transactions.amount,
+	COALESCE(transactions.income_item_id, transactions.expense_item_id), transactions.payment_method_id, transactions.date,
+	transactions.comment, transactions.student_id, transactions.teacher_id, transactions.created_by, transactions.created_at`
+
+func (m TransactionModel) GetTransaction(id uuid.UUID) (*Transaction, error) {
+	query := `SELECT ` + transactionColumns + `
+	FROM transactions
+	WHERE id = $1
+`
+
+	var t Transaction
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&t.ID,
+		&t.Direction,
+		&t.Amount,
+		&t.CategoryID,
+		&t.PaymentMethodID,
+		&t.Date,
+		&t.Comment,
+		&t.StudentID,
+		&t.TeacherID,
+		&t.CreatedBy,
+		&t.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	t.Date = TruncateToDate(t.Date)
+
+	return &t, nil
+}
+
+func (m TransactionModel) DeleteTransaction(id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM transactions WHERE id = $1`, id)
+	if err != nil {
+		switch {
+		case isForeignKeyViolation(err):
+			return ErrTransactionLinked
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// transactionFilterSQL is shared by the list and totals queries. A category
+// filter also matches all of its subcategories.
+const transactionFilterSQL = `WITH RECURSIVE categories AS (
+		SELECT id, parent_id FROM income_item
+		UNION ALL
+		SELECT id, parent_id FROM expense_item
+	), tree AS (
+		SELECT id FROM categories WHERE id = $4
+		UNION
+		SELECT categories.id FROM categories INNER JOIN tree ON categories.parent_id = tree.id
+	)
+	%s
+	FROM transactions
+	WHERE ($1::date IS NULL OR transactions.date >= $1)
+	AND ($2::date IS NULL OR transactions.date <= $2)
+	AND ($3::transaction_direction IS NULL OR transactions.direction = $3)
+	AND ($4::uuid IS NULL OR COALESCE(transactions.income_item_id, transactions.expense_item_id) IN (SELECT id FROM tree))
+	AND ($5::uuid IS NULL OR transactions.payment_method_id = $5)
+	AND ($6::uuid IS NULL OR transactions.student_id = $6)
+	AND ($7::uuid IS NULL OR transactions.teacher_id = $7)`
+
+func (tf TransactionFilter) args() []any {
+	return []any{tf.From, tf.To, tf.Direction, tf.CategoryID, tf.PaymentMethodID, tf.StudentID, tf.TeacherID}
+}
+
+func (m TransactionModel) GetAllTransactions(tf TransactionFilter, filters Filters) ([]*Transaction, Metadata, error) {
+	query := fmt.Sprintf(transactionFilterSQL, `SELECT COUNT(*) OVER(), `+transactionColumns) + `
+	` + filters.orderBy(nil, 8, "transactions.id ASC")
+
+	args := append(tf.args(), filters.limit(), filters.offset())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	transactions := []*Transaction{}
+
+	for rows.Next() {
+		var t Transaction
+
+		err := rows.Scan(
+			&totalRecords,
+			&t.ID,
+			&t.Direction,
+			&t.Amount,
+			&t.CategoryID,
+			&t.PaymentMethodID,
+			&t.Date,
+			&t.Comment,
+			&t.StudentID,
+			&t.TeacherID,
+			&t.CreatedBy,
+			&t.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		t.Date = TruncateToDate(t.Date)
+		transactions = append(transactions, &t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return transactions, metadata, nil
+}
+
+func (m TransactionModel) GetTotals(tf TransactionFilter) (Totals, error) {
+	query := fmt.Sprintf(transactionFilterSQL, `SELECT
+	COALESCE(SUM(transactions.amount) FILTER (WHERE transactions.direction = 'приход'), 0),
+	COALESCE(SUM(transactions.amount) FILTER (WHERE transactions.direction = 'расход'), 0)`)
+
+	var totals Totals
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, tf.args()...).Scan(&totals.Income, &totals.Expense)
+	if err != nil {
+		return Totals{}, err
+	}
+
+	totals.Balance = totals.Income - totals.Expense
+
+	return totals, nil
+}
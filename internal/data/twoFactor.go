@@ -0,0 +1,199 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+const recoveryCodesCount = 10
+
+// TwoFactorPermissions lists the permissions that can only be used by staff
+// who have two-factor authentication enabled.
+var TwoFactorPermissions = []string{"finance:read", "finance:write", "users:write"}
+
+func (p Permissions) RequireTwoFactor() bool {
+	for _, code := range TwoFactorPermissions {
+		if p.Include(code) {
+			return true
+		}
+	}
+	return false
+}
+
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodesCount)
+
+	for i := range codes {
+		randomBytes := make([]byte, 5)
+
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(randomBytes))
+		codes[i] = code[:4] + "-" + code[4:]
+	}
+
+	return codes, nil
+}
+
+func hashRecoveryCode(code string) []byte {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hash[:]
+}
+
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+// SetSecret stores a new, not yet confirmed TOTP secret for the user.
+func (m TwoFactorModel) SetSecret(user *User, secret string) error {
+	query := `UPDATE users
+	SET totp_secret = $1, totp_enabled = false, totp_last_counter = NULL
+	WHERE id = $2
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, secret, user.ID)
+	if err != nil {
+		return err
+	}
+
+	user.TOTPSecret = &secret
+	user.TOTPEnabled = false
+
+	return nil
+}
+
+// Enable turns two-factor authentication on and replaces the user's recovery
+// codes. The plaintext codes are returned once and never stored.
+func (m TwoFactorModel) Enable(user *User) ([]string, error) {
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET totp_enabled = true WHERE id = $1`, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (hash, user_id) VALUES ($1, $2)`, hashRecoveryCode(code), user.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPEnabled = true
+
+	return codes, nil
+}
+
+func (m TwoFactorModel) Disable(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET totp_secret = NULL, totp_enabled = false, totp_last_counter = NULL WHERE id = $1`, user.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	user.TOTPSecret = nil
+	user.TOTPEnabled = false
+
+	return nil
+}
+
+// UseCode records the time step of an accepted TOTP code. It reports false
+// when a code from that step or a later one was already used, which makes
+// every code single-use.
+func (m TwoFactorModel) UseCode(userID uuid.UUID, counter uint64) (bool, error) {
+	query := `UPDATE users
+	SET totp_last_counter = $1
+	WHERE id = $2 AND (totp_last_counter IS NULL OR totp_last_counter < $1)
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, int64(counter), userID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode marks a matching unused recovery code as used and reports
+// whether one was found.
+func (m TwoFactorModel) UseRecoveryCode(userID uuid.UUID, code string) (bool, error) {
+	query := `UPDATE recovery_codes
+	SET used_at = NOW()
+	WHERE hash = $1 AND user_id = $2 AND used_at IS NULL
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, hashRecoveryCode(code), userID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
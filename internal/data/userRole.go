@@ -0,0 +1,54 @@
+package data
+
+import "authCRM/internal/validator"
+
+type Role string
+
+const (
+	RoleAdmin      Role = "admin"
+	RoleManager    Role = "manager"
+	RoleAccountant Role = "accountant"
+	RoleTeacher    Role = "teacher"
+)
+
+// RolePermissions describes which permission codes every role is granted.
+var RolePermissions = map[Role]Permissions{
+	RoleAdmin: {
+		"students:read", "students:write",
+		"groups:read", "groups:write",
+		"attendance:write", "attendance:override",
+		"teachers:read", "teachers:write",
+		"cabinets:read", "cabinets:write",
+		"subscriptions:read", "subscriptions:write",
+		"finance:read", "finance:write",
+		"users:read", "users:write",
+	},
+	RoleManager: {
+		"students:read", "students:write",
+		"groups:read", "groups:write",
+		"attendance:write", "attendance:override",
+		"teachers:read", "teachers:write",
+		"cabinets:read", "cabinets:write",
+		"subscriptions:read",
+	},
+	RoleAccountant: {
+		"students:read",
+		"groups:read",
+		"teachers:read",
+		"subscriptions:read", "subscriptions:write",
+		"finance:read", "finance:write",
+	},
+	RoleTeacher: {
+		"students:read",
+		"groups:read",
+		"attendance:write",
+		"teachers:read",
+		"cabinets:read",
+		"subscriptions:read",
+	},
+}
+
+func ValidateRole(v *validator.Validator, role Role) {
+	_, ok := RolePermissions[role]
+	v.Check(ok, "role", "неизвестная роль")
+}
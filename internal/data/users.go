@@ -3,8 +3,10 @@ package data
 import (
 	"authCRM/internal/validator"
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"regexp"
@@ -15,6 +17,8 @@ var (
 	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 )
 
+var AnonymousUser = &User{}
+
 type User struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_At"`
@@ -22,7 +26,19 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	Role      *Role     `json:"role"`
+	Version   int       `json:"version"`
+
+	FailedLoginAttempts int        `json:"-"`
+	LastFailedLoginAt   *time.Time `json:"-"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty"`
+
+	TOTPSecret  *string `json:"-"`
+	TOTPEnabled bool    `json:"totp_enabled"`
+}
+
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
 }
 
 type password struct {
@@ -38,7 +54,7 @@ func ValidateEmail(v *validator.Validator, email string) {
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(password != "", "password", "must be provided")
 	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
-	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+	v.Check(len(password) <= 1024, "password", "must not be more than 1024 bytes long")
 }
 
 func ValidateUser(v *validator.Validator, user *User) {
@@ -57,7 +73,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 }
 
 func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	hash, err := hashArgon2id(plaintextPassword, PasswordParams)
 	if err != nil {
 		return err
 	}
@@ -68,7 +84,13 @@ func (p *password) Set(plaintextPassword string) error {
 	return nil
 }
 
+// Matches checks the password against an argon2id hash, or a bcrypt hash
+// for accounts created before argon2id was introduced.
 func (p *password) Matches(plaintextPassword string) (bool, error) {
+	if isArgon2id(p.hash) {
+		return matchArgon2id(plaintextPassword, p.hash)
+	}
+
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
 	if err != nil {
 		switch {
@@ -82,6 +104,21 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, err
 }
 
+// NeedsRehash reports whether the hash is a legacy bcrypt hash or was made
+// with parameters other than the current PasswordParams.
+func (p *password) NeedsRehash() bool {
+	if !isArgon2id(p.hash) {
+		return true
+	}
+
+	params, _, _, err := decodeArgon2id(p.hash)
+	if err != nil {
+		return true
+	}
+
+	return params != PasswordParams
+}
+
 var (
 	ErrDuplicateEmail = errors.New("уже есть пользователь с такой почтой!")
 )
@@ -113,7 +150,8 @@ func (u UserModel) InsertUser(user *User) error {
 }
 
 func (u UserModel) GetByEmail(email string) (*User, error) {
-	query := `SELECT id, created_at, full_name, email, password_hash, activated, version
+	query := `SELECT id, created_at, full_name, email, password_hash, activated, role, version,
+	failed_login_attempts, last_failed_login_at, locked_until, totp_secret, totp_enabled
 	FROM users
 	WHERE email = $1
 `
@@ -130,7 +168,52 @@ func (u UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Role,
+		&user.Version,
+		&user.FailedLoginAttempts,
+		&user.LastFailedLoginAt,
+		&user.LockedUntil,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func (u UserModel) GetUser(id uuid.UUID) (*User, error) {
+	query := `SELECT id, created_at, full_name, email, password_hash, activated, role, version,
+	failed_login_attempts, last_failed_login_at, locked_until, totp_secret, totp_enabled
+	FROM users
+	WHERE id = $1
+`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := u.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.FullName,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Role,
 		&user.Version,
+		&user.FailedLoginAttempts,
+		&user.LastFailedLoginAt,
+		&user.LockedUntil,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
 	)
 
 	if err != nil {
@@ -145,6 +228,38 @@ func (u UserModel) GetByEmail(email string) (*User, error) {
 }
 
 func (u UserModel) UpdateUser(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return updateUser(ctx, u.DB, user)
+}
+
+// UpdateUserWithRole saves the user and switches their role in one
+// transaction, so a failed role change doesn't leave the other edits applied.
+func (u UserModel) UpdateUserWithRole(user *User, role Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateUser(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	err = grantRole(ctx, tx, user, role)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func updateUser(ctx context.Context, db rowQueryer, user *User) error {
 	query := `
 	UPDATE users
 	SET full_name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
@@ -160,10 +275,8 @@ func (u UserModel) UpdateUser(user *User) error {
 		user.ID,
 		user.Version,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 
-	err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	err := db.QueryRowContext(ctx, query, args...).Scan(&user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -176,3 +289,99 @@ func (u UserModel) UpdateUser(user *User) error {
 	}
 	return nil
 }
+
+func (u UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `SELECT users.id, users.created_at, users.full_name, users.email, users.password_hash, users.activated, users.role, users.version,
+	users.totp_secret, users.totp_enabled
+	FROM users
+	INNER JOIN tokens
+	ON users.id = tokens.user_id
+	WHERE tokens.hash = $1
+	AND tokens.scope = $2
+	AND tokens.expiry > $3
+`
+
+	args := []any{tokenHash[:], tokenScope, time.Now()}
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := u.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.FullName,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Role,
+		&user.Version,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (u UserModel) GetAllUsers(search string, activated *bool, role *Role, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`SELECT COUNT(*) OVER(), id, created_at, full_name, email, activated, role, version, locked_until, totp_enabled
+	FROM users
+	WHERE (to_tsvector('simple', full_name) @@ plainto_tsquery('simple', $1) OR email ILIKE '%%' || $1 || '%%' OR $1 = '')
+	AND ($2::boolean IS NULL OR activated = $2)
+	AND ($3::user_role IS NULL OR role = $3)
+	%s`, filters.orderBy(nil, 4, "id ASC"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := u.DB.QueryContext(ctx, query, search, activated, role, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.FullName,
+			&user.Email,
+			&user.Activated,
+			&user.Role,
+			&user.Version,
+			&user.LockedUntil,
+			&user.TOTPEnabled,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
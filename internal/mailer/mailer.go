@@ -0,0 +1,82 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"github.com/go-mail/mail/v2"
+	"html/template"
+	"path"
+	"time"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+const (
+	LangRussian = "ru"
+	LangEnglish = "en"
+)
+
+type Mailer struct {
+	dialer *mail.Dialer
+	sender string
+}
+
+func New(host string, port int, username, password, sender string) Mailer {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+
+	return Mailer{
+		dialer: dialer,
+		sender: sender,
+	}
+}
+
+// Send renders templateFile from the directory of the given language (falling
+// back to Russian) and delivers it to recipient over SMTP.
+func (m Mailer) Send(recipient, lang, templateFile string, data any) error {
+	if lang != LangEnglish {
+		lang = LangRussian
+	}
+
+	tmpl, err := template.New("email").ParseFS(templateFS, path.Join("templates", lang, templateFile))
+	if err != nil {
+		return err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return err
+	}
+
+	msg := mail.NewMessage()
+	msg.SetHeader("To", recipient)
+	msg.SetHeader("From", m.sender)
+	msg.SetHeader("Subject", subject.String())
+	msg.SetBody("text/plain", plainBody.String())
+	msg.AddAlternative("text/html", htmlBody.String())
+
+	for i := 1; i <= 3; i++ {
+		err = m.dialer.DialAndSend(msg)
+		if err == nil {
+			return nil
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return err
+}
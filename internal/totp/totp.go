@@ -0,0 +1,117 @@
+// Package totp implements time-based one-time passwords (RFC 6238) with the
+// parameters understood by common authenticator apps: HMAC-SHA1, 6 digits and
+// a 30 second period.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Period = 30
+	Digits = 6
+	// Skew is the number of periods before and after the current one that
+	// are still accepted, to tolerate clock drift on the user's device.
+	Skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateSecret() (string, error) {
+	randomBytes := make([]byte, 20)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(randomBytes), nil
+}
+
+// URI builds the otpauth:// link that authenticator apps read from a QR code.
+func URI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(Period))
+
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+func Code(secret string, t time.Time) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	return code(key, counter(t)), nil
+}
+
+// Validate reports whether passcode is valid for the secret at time t.
+func Validate(passcode, secret string, t time.Time) bool {
+	_, ok := Verify(passcode, secret, t)
+	return ok
+}
+
+// Verify is Validate that also returns the time step the passcode belongs
+// to. Callers store the step of the last accepted code and refuse codes at
+// or before it, so a code can't be replayed within its window.
+func Verify(passcode, secret string, t time.Time) (uint64, bool) {
+	passcode = strings.TrimSpace(passcode)
+	if len(passcode) != Digits {
+		return 0, false
+	}
+
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	current := counter(t)
+
+	for i := -Skew; i <= Skew; i++ {
+		step := uint64(int64(current) + int64(i))
+		expected := code(key, step)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(passcode)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+func counter(t time.Time) uint64 {
+	return uint64(t.Unix() / Period)
+}
+
+func code(key []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", Digits, value%mod)
+}
@@ -0,0 +1,123 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed from RFC 6238, Appendix B ("12345678901234567890"),
+// base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC lists 8-digit codes; ours are their last 6 digits.
+var rfcVectors = []struct {
+	unix    int64
+	counter uint64
+	code    string
+}{
+	{59, 1, "287082"},
+	{1111111109, 37037036, "081804"},
+	{1111111111, 37037037, "050471"},
+	{1234567890, 41152263, "005924"},
+	{2000000000, 66666666, "279037"},
+	{20000000000, 666666666, "353130"},
+}
+
+func TestCounter(t *testing.T) {
+	for _, tt := range rfcVectors {
+		if got := counter(time.Unix(tt.unix, 0)); got != tt.counter {
+			t.Errorf("counter(%d) = %d, want %d", tt.unix, got, tt.counter)
+		}
+	}
+}
+
+func TestCode(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	for _, tt := range rfcVectors {
+		if got := code(key, tt.counter); got != tt.code {
+			t.Errorf("code(%d) = %q, want %q", tt.counter, got, tt.code)
+		}
+
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.code {
+			t.Errorf("Code(%d) = %q, want %q", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	tests := []struct {
+		name   string
+		offset time.Duration
+		want   bool
+	}{
+		{"current step", 0, true},
+		{"one step behind", -Period * time.Second, true},
+		{"one step ahead", Period * time.Second, true},
+		{"two steps behind", -2 * Period * time.Second, false},
+		{"two steps ahead", 2 * Period * time.Second, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passcode, err := Code(rfcSecret, now.Add(tt.offset))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := Validate(passcode, rfcSecret, now); got != tt.want {
+				t.Errorf("Validate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyReturnsStep(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	passcode, err := Code(rfcSecret, now.Add(-Period*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := Verify(passcode, rfcSecret, now)
+	if !ok {
+		t.Fatal("Verify rejected a code from the previous step")
+	}
+	if want := counter(now) - 1; step != want {
+		t.Errorf("step = %d, want %d", step, want)
+	}
+}
+
+func TestValidateRejectsMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	tests := []struct {
+		name     string
+		passcode string
+		secret   string
+	}{
+		{"wrong code", "000000", rfcSecret},
+		{"too short", "28708", rfcSecret},
+		{"too long", "2870820", rfcSecret},
+		{"bad secret", "287082", "not base32!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if Validate(tt.passcode, tt.secret, now) {
+				t.Errorf("Validate(%q) = true, want false", tt.passcode)
+			}
+		})
+	}
+
+	if !Validate(" 287082 ", rfcSecret, now) {
+		t.Error("Validate should ignore surrounding spaces")
+	}
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS users_permissions;
+DROP TABLE IF EXISTS permissions;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
+DROP TYPE IF EXISTS user_role;
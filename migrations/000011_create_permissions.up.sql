@@ -0,0 +1,27 @@
+CREATE TYPE user_role AS ENUM ('admin', 'manager', 'accountant', 'teacher');
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role user_role;
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id bigserial PRIMARY KEY,
+    code text NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id uuid NOT NULL REFERENCES users ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+INSERT INTO permissions (code)
+VALUES
+    ('teachers:read'),
+    ('teachers:write'),
+    ('cabinets:read'),
+    ('cabinets:write'),
+    ('subscriptions:read'),
+    ('subscriptions:write'),
+    ('finance:read'),
+    ('finance:write'),
+    ('users:read'),
+    ('users:write');
@@ -0,0 +1,13 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_login_attempts integer NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_failed_login_at timestamp(0) with time zone;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until timestamp(0) with time zone;
+
+CREATE TABLE IF NOT EXISTS user_lockouts (
+    id bigserial PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users ON DELETE CASCADE,
+    failed_attempts integer NOT NULL,
+    locked_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    locked_until timestamp(0) with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_lockouts_user_id_idx ON user_lockouts(user_id);
@@ -0,0 +1,7 @@
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS id uuid NOT NULL UNIQUE DEFAULT uuid_generate_v4();
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS created_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS last_used_at timestamp(0) with time zone;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS ip text;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS user_agent text;
+
+CREATE INDEX IF NOT EXISTS tokens_user_id_idx ON tokens(user_id);
@@ -0,0 +1 @@
+DELETE FROM permissions WHERE code IN ('students:read', 'students:write');
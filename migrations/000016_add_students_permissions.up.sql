@@ -0,0 +1,12 @@
+INSERT INTO permissions (code)
+VALUES
+    ('students:read'),
+    ('students:write')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users.id, permissions.id
+FROM users, permissions
+WHERE (permissions.code = 'students:read' AND users.role IN ('admin', 'manager', 'accountant', 'teacher'))
+   OR (permissions.code = 'students:write' AND users.role IN ('admin', 'manager'))
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code IN ('groups:read', 'groups:write');
+DROP TABLE IF EXISTS group_students;
+DROP TABLE IF EXISTS groups;
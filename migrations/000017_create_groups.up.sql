@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS groups (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name text NOT NULL,
+    course text NOT NULL,
+    teacher_id uuid REFERENCES teachers ON DELETE SET NULL,
+    cabinet_id uuid REFERENCES cabinets ON DELETE SET NULL,
+    capacity integer NOT NULL CHECK (capacity > 0),
+    level text,
+    start_date date NOT NULL,
+    end_date date,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    CHECK (end_date IS NULL OR end_date >= start_date)
+);
+
+CREATE TABLE IF NOT EXISTS group_students (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    group_id uuid NOT NULL REFERENCES groups ON DELETE CASCADE,
+    student_id uuid NOT NULL REFERENCES students ON DELETE CASCADE,
+    enrolled_at date NOT NULL,
+    left_at date,
+    CHECK (left_at IS NULL OR left_at >= enrolled_at)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS group_students_active_idx ON group_students(group_id, student_id) WHERE left_at IS NULL;
+CREATE INDEX IF NOT EXISTS group_students_student_id_idx ON group_students(student_id);
+
+INSERT INTO permissions (code)
+VALUES
+    ('groups:read'),
+    ('groups:write')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users.id, permissions.id
+FROM users, permissions
+WHERE (permissions.code = 'groups:read' AND users.role IN ('admin', 'manager', 'accountant', 'teacher'))
+   OR (permissions.code = 'groups:write' AND users.role IN ('admin', 'manager'))
+ON CONFLICT DO NOTHING;
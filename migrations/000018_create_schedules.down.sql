@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS lessons;
+DROP TYPE IF EXISTS lesson_status;
+DROP TABLE IF EXISTS schedule_exceptions;
+DROP TABLE IF EXISTS schedules;
@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS schedules (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    group_id uuid NOT NULL REFERENCES groups ON DELETE CASCADE,
+    teacher_id uuid REFERENCES teachers ON DELETE SET NULL,
+    cabinet_id uuid REFERENCES cabinets ON DELETE SET NULL,
+    weekdays integer[] NOT NULL,
+    start_time time NOT NULL,
+    end_time time NOT NULL,
+    interval_weeks integer NOT NULL DEFAULT 1 CHECK (interval_weeks > 0),
+    timezone text NOT NULL DEFAULT 'UTC',
+    starts_on date NOT NULL,
+    until date,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    CHECK (end_time > start_time),
+    CHECK (until IS NULL OR until >= starts_on)
+);
+
+CREATE INDEX IF NOT EXISTS schedules_group_id_idx ON schedules(group_id);
+
+CREATE TABLE IF NOT EXISTS schedule_exceptions (
+    schedule_id uuid NOT NULL REFERENCES schedules ON DELETE CASCADE,
+    date date NOT NULL,
+    PRIMARY KEY (schedule_id, date)
+);
+
+CREATE TYPE lesson_status AS ENUM ('запланирован', 'проведен', 'отменен');
+
+CREATE TABLE IF NOT EXISTS lessons (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    group_id uuid NOT NULL REFERENCES groups ON DELETE CASCADE,
+    schedule_id uuid REFERENCES schedules ON DELETE SET NULL,
+    teacher_id uuid REFERENCES teachers ON DELETE SET NULL,
+    cabinet_id uuid REFERENCES cabinets ON DELETE SET NULL,
+    date date NOT NULL,
+    starts_at timestamp(0) with time zone NOT NULL,
+    ends_at timestamp(0) with time zone NOT NULL,
+    status lesson_status NOT NULL DEFAULT 'запланирован',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    CHECK (ends_at > starts_at),
+    UNIQUE (schedule_id, date)
+);
+
+CREATE INDEX IF NOT EXISTS lessons_group_id_starts_at_idx ON lessons(group_id, starts_at);
+CREATE INDEX IF NOT EXISTS lessons_starts_at_idx ON lessons(starts_at);
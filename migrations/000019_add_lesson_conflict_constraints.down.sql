@@ -0,0 +1,2 @@
+ALTER TABLE lessons DROP CONSTRAINT IF EXISTS lessons_teacher_overlap_excl;
+ALTER TABLE lessons DROP CONSTRAINT IF EXISTS lessons_cabinet_overlap_excl;
@@ -0,0 +1,9 @@
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+ALTER TABLE lessons ADD CONSTRAINT lessons_cabinet_overlap_excl
+    EXCLUDE USING gist (cabinet_id WITH =, tstzrange(starts_at, ends_at) WITH &&)
+    WHERE (status <> 'отменен');
+
+ALTER TABLE lessons ADD CONSTRAINT lessons_teacher_overlap_excl
+    EXCLUDE USING gist (teacher_id WITH =, tstzrange(starts_at, ends_at) WITH &&)
+    WHERE (status <> 'отменен');
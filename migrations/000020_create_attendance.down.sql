@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code IN ('attendance:write', 'attendance:override');
+DROP TABLE IF EXISTS attendance;
+DROP TYPE IF EXISTS attendance_status;
@@ -0,0 +1,30 @@
+CREATE TYPE attendance_status AS ENUM ('присутствовал', 'опоздал', 'отсутствовал по уважительной', 'отсутствовал без уважительной');
+
+CREATE TABLE IF NOT EXISTS attendance (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    lesson_id uuid NOT NULL REFERENCES lessons ON DELETE CASCADE,
+    student_id uuid NOT NULL REFERENCES students ON DELETE CASCADE,
+    status attendance_status NOT NULL,
+    student_subscription_id uuid,
+    charged boolean NOT NULL DEFAULT false,
+    overridden boolean NOT NULL DEFAULT false,
+    marked_by uuid REFERENCES users ON DELETE SET NULL,
+    marked_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (lesson_id, student_id)
+);
+
+CREATE INDEX IF NOT EXISTS attendance_student_id_idx ON attendance(student_id);
+CREATE INDEX IF NOT EXISTS attendance_student_subscription_id_idx ON attendance(student_subscription_id);
+
+INSERT INTO permissions (code)
+VALUES
+    ('attendance:write'),
+    ('attendance:override')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users.id, permissions.id
+FROM users, permissions
+WHERE (permissions.code = 'attendance:write' AND users.role IN ('admin', 'manager', 'teacher'))
+   OR (permissions.code = 'attendance:override' AND users.role IN ('admin', 'manager'))
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS student_subscriptions;
+
+DROP TYPE IF EXISTS student_sub_status;
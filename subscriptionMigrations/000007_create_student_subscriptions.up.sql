@@ -0,0 +1,22 @@
+CREATE TYPE student_sub_status AS enum ('активный', 'истек', 'исчерпан', 'заморожен');
+
+CREATE TABLE IF NOT EXISTS student_subscriptions (
+    id uuid primary key DEFAULT uuid_generate_v4(),
+    student_id uuid NOT NULL REFERENCES students,
+    subscription_id uuid NOT NULL REFERENCES subscriptions,
+    name VARCHAR(255) NOT NULL,
+    price INT NOT NULL CHECK (price >= 0),
+    type sub_status NOT NULL,
+    duration_months INT NULL,
+    sessions_count INT NULL,
+    validity_months INT NULL,
+    start_date date NOT NULL,
+    end_date date NULL,
+    sessions_remaining INT NULL CHECK (sessions_remaining IS NULL OR sessions_remaining >= 0),
+    status student_sub_status NOT NULL DEFAULT 'активный',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS student_subscriptions_student_id_idx ON student_subscriptions(student_id);
+CREATE INDEX IF NOT EXISTS student_subscriptions_status_idx ON student_subscriptions(status);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS subscription_freezes;
+
+ALTER TABLE student_subscriptions DROP COLUMN IF EXISTS max_freeze_days;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS max_freeze_days;
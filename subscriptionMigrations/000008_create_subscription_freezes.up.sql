@@ -0,0 +1,15 @@
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS max_freeze_days INT NULL CHECK (max_freeze_days IS NULL OR max_freeze_days >= 0);
+ALTER TABLE student_subscriptions ADD COLUMN IF NOT EXISTS max_freeze_days INT NULL;
+
+CREATE TABLE IF NOT EXISTS subscription_freezes (
+    id uuid primary key DEFAULT uuid_generate_v4(),
+    student_subscription_id uuid NOT NULL REFERENCES student_subscriptions ON DELETE CASCADE,
+    start_date date NOT NULL,
+    end_date date NOT NULL,
+    reason text NOT NULL,
+    created_by uuid REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CHECK (end_date >= start_date)
+);
+
+CREATE INDEX IF NOT EXISTS subscription_freezes_student_subscription_id_idx ON subscription_freezes(student_subscription_id);
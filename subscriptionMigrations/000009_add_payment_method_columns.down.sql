@@ -0,0 +1,6 @@
+ALTER TABLE payment_method DROP COLUMN IF EXISTS version;
+ALTER TABLE payment_method DROP COLUMN IF EXISTS created_at;
+ALTER TABLE payment_method DROP COLUMN IF EXISTS archived_at;
+ALTER TABLE payment_method DROP COLUMN IF EXISTS commission_percent;
+ALTER TABLE payment_method DROP COLUMN IF EXISTS sort_order;
+ALTER TABLE payment_method DROP COLUMN IF EXISTS active;
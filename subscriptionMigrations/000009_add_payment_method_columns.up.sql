@@ -0,0 +1,6 @@
+ALTER TABLE payment_method ADD COLUMN IF NOT EXISTS active boolean NOT NULL DEFAULT true;
+ALTER TABLE payment_method ADD COLUMN IF NOT EXISTS sort_order integer NOT NULL DEFAULT 0;
+ALTER TABLE payment_method ADD COLUMN IF NOT EXISTS commission_percent numeric(5, 2) NULL CHECK (commission_percent IS NULL OR (commission_percent >= 0 AND commission_percent <= 100));
+ALTER TABLE payment_method ADD COLUMN IF NOT EXISTS archived_at timestamp(0) with time zone NULL;
+ALTER TABLE payment_method ADD COLUMN IF NOT EXISTS created_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+ALTER TABLE payment_method ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS transactions;
+DROP TYPE IF EXISTS transaction_direction;
+
+ALTER TABLE expense_item DROP COLUMN IF EXISTS version;
+ALTER TABLE expense_item DROP COLUMN IF EXISTS created_at;
+ALTER TABLE expense_item DROP COLUMN IF EXISTS parent_id;
+
+ALTER TABLE income_item DROP COLUMN IF EXISTS version;
+ALTER TABLE income_item DROP COLUMN IF EXISTS created_at;
+ALTER TABLE income_item DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,31 @@
+ALTER TABLE income_item ADD COLUMN IF NOT EXISTS parent_id uuid NULL REFERENCES income_item ON DELETE RESTRICT;
+ALTER TABLE income_item ADD COLUMN IF NOT EXISTS created_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+ALTER TABLE income_item ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+
+ALTER TABLE expense_item ADD COLUMN IF NOT EXISTS parent_id uuid NULL REFERENCES expense_item ON DELETE RESTRICT;
+ALTER TABLE expense_item ADD COLUMN IF NOT EXISTS created_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+ALTER TABLE expense_item ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+
+CREATE TYPE transaction_direction AS ENUM ('приход', 'расход');
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id uuid primary key DEFAULT uuid_generate_v4(),
+    direction transaction_direction NOT NULL,
+    amount bigint NOT NULL CHECK (amount > 0),
+    income_item_id uuid NULL REFERENCES income_item ON DELETE RESTRICT,
+    expense_item_id uuid NULL REFERENCES expense_item ON DELETE RESTRICT,
+    payment_method_id uuid NOT NULL REFERENCES payment_method ON DELETE RESTRICT,
+    date date NOT NULL,
+    comment text NOT NULL DEFAULT '',
+    student_id uuid NULL REFERENCES students ON DELETE SET NULL,
+    teacher_id uuid NULL REFERENCES teachers ON DELETE SET NULL,
+    created_by uuid NULL REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CHECK (
+        (direction = 'приход' AND income_item_id IS NOT NULL AND expense_item_id IS NULL) OR
+        (direction = 'расход' AND expense_item_id IS NOT NULL AND income_item_id IS NULL)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS transactions_date_idx ON transactions(date);
+CREATE INDEX IF NOT EXISTS transactions_student_id_idx ON transactions(student_id);
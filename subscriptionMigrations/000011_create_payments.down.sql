@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS payments;
+
+DELETE FROM income_item
+WHERE id = '6f1c2b0e-3d4a-4c55-9b7e-1a2f3c4d5e60'
+AND NOT EXISTS (SELECT 1 FROM transactions WHERE income_item_id = '6f1c2b0e-3d4a-4c55-9b7e-1a2f3c4d5e60');
@@ -0,0 +1,17 @@
+INSERT INTO income_item (id, name)
+VALUES ('6f1c2b0e-3d4a-4c55-9b7e-1a2f3c4d5e60', 'Оплата абонементов')
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS payments (
+    id uuid primary key DEFAULT uuid_generate_v4(),
+    student_subscription_id uuid NOT NULL REFERENCES student_subscriptions ON DELETE RESTRICT,
+    amount bigint NOT NULL CHECK (amount > 0),
+    payment_method_id uuid NOT NULL REFERENCES payment_method ON DELETE RESTRICT,
+    transaction_id uuid NOT NULL UNIQUE REFERENCES transactions ON DELETE RESTRICT,
+    date date NOT NULL,
+    comment text NOT NULL DEFAULT '',
+    created_by uuid NULL REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS payments_student_subscription_id_idx ON payments(student_subscription_id);
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS payroll_items;
+DROP TABLE IF EXISTS payrolls;
+DROP TYPE IF EXISTS payroll_status;
+
+DELETE FROM expense_item
+WHERE id = '0b7d5e2a-8c1f-4e3b-a6d9-2f4e6a8c0b13'
+AND NOT EXISTS (SELECT 1 FROM transactions WHERE expense_item_id = '0b7d5e2a-8c1f-4e3b-a6d9-2f4e6a8c0b13');
+
+DROP TABLE IF EXISTS teacher_salary_rates;
+DROP TABLE IF EXISTS salary_rates;
+DROP TYPE IF EXISTS salary_scheme;
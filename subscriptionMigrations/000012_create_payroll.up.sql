@@ -0,0 +1,64 @@
+CREATE TYPE salary_scheme AS ENUM ('оклад', 'за урок', 'за ученика', 'процент от выручки');
+
+CREATE TABLE IF NOT EXISTS salary_rates (
+    id uuid primary key DEFAULT uuid_generate_v4(),
+    name text NOT NULL,
+    scheme salary_scheme NOT NULL,
+    amount bigint NULL CHECK (amount IS NULL OR amount >= 0),
+    percent numeric(5,2) NULL CHECK (percent IS NULL OR (percent >= 0 AND percent <= 100)),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    CHECK (
+        (scheme = 'процент от выручки' AND percent IS NOT NULL AND amount IS NULL) OR
+        (scheme <> 'процент от выручки' AND amount IS NOT NULL AND percent IS NULL)
+    )
+);
+
+CREATE TABLE IF NOT EXISTS teacher_salary_rates (
+    id uuid primary key DEFAULT uuid_generate_v4(),
+    teacher_id uuid NOT NULL REFERENCES teachers ON DELETE CASCADE,
+    salary_rate_id uuid NOT NULL REFERENCES salary_rates ON DELETE RESTRICT,
+    effective_from date NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (teacher_id, effective_from)
+);
+
+INSERT INTO expense_item (id, name)
+VALUES ('0b7d5e2a-8c1f-4e3b-a6d9-2f4e6a8c0b13', 'Зарплата преподавателей')
+ON CONFLICT DO NOTHING;
+
+CREATE TYPE payroll_status AS ENUM ('черновик', 'проведен');
+
+CREATE TABLE IF NOT EXISTS payrolls (
+    id uuid primary key DEFAULT uuid_generate_v4(),
+    period_from date NOT NULL,
+    period_to date NOT NULL,
+    status payroll_status NOT NULL DEFAULT 'черновик',
+    total bigint NOT NULL DEFAULT 0,
+    created_by uuid NULL REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    approved_by uuid NULL REFERENCES users ON DELETE SET NULL,
+    approved_at timestamp(0) with time zone NULL,
+    version integer NOT NULL DEFAULT 1,
+    CHECK (period_to >= period_from)
+);
+
+CREATE TABLE IF NOT EXISTS payroll_items (
+    id uuid primary key DEFAULT uuid_generate_v4(),
+    payroll_id uuid NOT NULL REFERENCES payrolls ON DELETE CASCADE,
+    teacher_id uuid NULL REFERENCES teachers ON DELETE SET NULL,
+    teacher_name text NOT NULL,
+    salary_rate_id uuid NULL REFERENCES salary_rates ON DELETE SET NULL,
+    scheme salary_scheme NOT NULL,
+    lesson_id uuid NULL REFERENCES lessons ON DELETE SET NULL,
+    group_id uuid NULL REFERENCES groups ON DELETE SET NULL,
+    date date NOT NULL,
+    description text NOT NULL,
+    quantity integer NOT NULL DEFAULT 0,
+    base bigint NOT NULL DEFAULT 0,
+    amount bigint NOT NULL CHECK (amount >= 0),
+    transaction_id uuid NULL REFERENCES transactions ON DELETE RESTRICT
+);
+
+CREATE INDEX IF NOT EXISTS payroll_items_payroll_id_idx ON payroll_items(payroll_id);
+CREATE INDEX IF NOT EXISTS payroll_items_lesson_id_idx ON payroll_items(lesson_id);
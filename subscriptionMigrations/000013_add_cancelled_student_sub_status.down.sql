@@ -0,0 +1,3 @@
+-- PostgreSQL can't drop a value from an enum; cancelled subscriptions are
+-- moved to the expired status and the value is left in place.
+UPDATE student_subscriptions SET status = 'истек' WHERE status = 'отменен';
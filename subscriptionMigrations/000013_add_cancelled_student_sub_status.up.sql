@@ -0,0 +1 @@
+ALTER TYPE student_sub_status ADD VALUE IF NOT EXISTS 'отменен';
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS subscription_cancellations;
+
+DELETE FROM expense_item
+WHERE id = 'c3e8a1d4-5b6f-4a27-8e90-7d1c2b3a4f55'
+AND NOT EXISTS (SELECT 1 FROM transactions WHERE expense_item_id = 'c3e8a1d4-5b6f-4a27-8e90-7d1c2b3a4f55');
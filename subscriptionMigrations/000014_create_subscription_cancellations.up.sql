@@ -0,0 +1,23 @@
+INSERT INTO expense_item (id, name)
+VALUES ('c3e8a1d4-5b6f-4a27-8e90-7d1c2b3a4f55', 'Возвраты за абонементы')
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS subscription_cancellations (
+    id uuid primary key DEFAULT uuid_generate_v4(),
+    student_subscription_id uuid NOT NULL UNIQUE REFERENCES student_subscriptions ON DELETE RESTRICT,
+    date date NOT NULL,
+    price bigint NOT NULL,
+    used integer NOT NULL,
+    total integer NOT NULL,
+    used_value bigint NOT NULL,
+    fee bigint NOT NULL DEFAULT 0 CHECK (fee >= 0),
+    charged bigint NOT NULL,
+    paid bigint NOT NULL,
+    refund bigint NOT NULL CHECK (refund >= 0),
+    payment_method_id uuid NULL REFERENCES payment_method ON DELETE RESTRICT,
+    transaction_id uuid NULL UNIQUE REFERENCES transactions ON DELETE RESTRICT,
+    reason text NOT NULL,
+    approved_by uuid NULL REFERENCES users ON DELETE SET NULL,
+    approved_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CHECK (refund = 0 OR (payment_method_id IS NOT NULL AND transaction_id IS NOT NULL))
+);
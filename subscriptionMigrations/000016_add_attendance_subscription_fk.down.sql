@@ -0,0 +1 @@
+ALTER TABLE attendance DROP CONSTRAINT IF EXISTS attendance_student_subscription_id_fkey;
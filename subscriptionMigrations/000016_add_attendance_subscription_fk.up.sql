@@ -0,0 +1,5 @@
+-- attendance is created in migrations/, which runs before this directory;
+-- the reference to student_subscriptions can only be added once both exist.
+ALTER TABLE attendance
+    ADD CONSTRAINT attendance_student_subscription_id_fkey
+    FOREIGN KEY (student_subscription_id) REFERENCES student_subscriptions ON DELETE SET NULL;
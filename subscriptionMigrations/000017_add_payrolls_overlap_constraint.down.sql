@@ -0,0 +1 @@
+ALTER TABLE payrolls DROP CONSTRAINT IF EXISTS payrolls_posted_overlap_excl;
@@ -0,0 +1,3 @@
+ALTER TABLE payrolls ADD CONSTRAINT payrolls_posted_overlap_excl
+    EXCLUDE USING gist (daterange(period_from, period_to, '[]') WITH &&)
+    WHERE (status = 'проведен');